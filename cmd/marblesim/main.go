@@ -0,0 +1,106 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// marblesim runs one of the chaincodes in this repo against local state, with a REPL or a script.
+//
+//	marblesim [-chaincode experimental] [-state session.json] [-script commands.txt] [-time secs] [-v]
+//	marblesim [-chaincode experimental] -replay txlog.ndjson
+//
+// The chaincodes are main packages, so marblesim builds the chosen one with the marblesim tag
+// and runs the result. Everything after -chaincode is passed on, see the sim package for the commands.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+var chaincodes = []string{"experimental", "hyperledger/part1", "hyperledger/part2"}
+
+func main() {
+	chaincode := "experimental"
+	args := os.Args[1:]
+	if len(args) >= 2 && (args[0] == "-chaincode" || args[0] == "--chaincode") {
+		chaincode, args = args[1], args[2:]
+	} else if len(args) >= 1 && strings.HasPrefix(args[0], "-chaincode=") {
+		chaincode, args = strings.TrimPrefix(args[0], "-chaincode="), args[1:]
+	}
+	known := false
+	for _, name := range chaincodes {
+		known = known || name == chaincode
+	}
+	if !known {
+		fmt.Println("unknown chaincode " + chaincode + ", expecting one of " + strings.Join(chaincodes, ", "))
+		os.Exit(2)
+	}
+
+	root, err := repoRoot()
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		os.Exit(1)
+	}
+	tmp, err := ioutil.TempDir("", "marblesim")
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		os.Exit(1)
+	}
+	defer os.RemoveAll(tmp)
+	bin := filepath.Join(tmp, "sim")
+	build := exec.Command("go", "build", "-tags", "marblesim", "-o", bin, "./"+chaincode)
+	build.Dir = root
+	build.Stdout, build.Stderr = os.Stderr, os.Stderr
+	if err := build.Run(); err != nil {
+		fmt.Println("Error building " + chaincode + ": " + err.Error())
+		os.Exit(1)
+	}
+
+	cmd := exec.Command(bin, args...) //from the working directory, so relative -state and -script paths work
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	err = cmd.Run()
+	if exit, ok := err.(*exec.ExitError); ok {
+		os.RemoveAll(tmp)
+		os.Exit(exit.ExitCode())
+	}
+	if err != nil {
+		fmt.Println("Error: " + err.Error())
+		os.Exit(1)
+	}
+}
+
+// repoRoot walks up from the working directory to the checkout that holds the sim package.
+func repoRoot() (string, error) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, "sim", "sim.go")); err == nil {
+			return dir, nil
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", fmt.Errorf("run marblesim from inside the marbles-chaincode checkout")
+		}
+		dir = parent
+	}
+}
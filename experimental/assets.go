@@ -0,0 +1,632 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"encoding/json"
+	"strings"
+)
+
+var assetTypeIndexStr = "_assettypeindex"	//name for the key/value that will store a list of all asset type names
+var assetTypePrefix = "_assettype_"			//prefix for the key/value that stores an asset type
+var assetPrefix = "_asset_"					//prefix for the key/value that stores an asset, _asset_<type>_<id>
+var assetIndexPrefix = "_assetindex_"		//prefix for the list of all ids of a type, _assetindex_<type>
+var assetLookupPrefix = "_assetidx_"		//prefix for the list of ids with a field value, _assetidx_<type>_<field>_<value>
+var assetTradesStr = "_assettrades"			//name for the key/value that will store all open asset trades
+
+// Marbles are not asset types, they keep their own invokes and keys. The registry is for new kinds of assets
+type AssetType struct{
+	Name string `json:"name"`
+	Fields map[string]AttributeSpec `json:"fields"`	//fields an asset of this type may carry
+	Indexes []string `json:"indexes"`		//fields with a lookup list, "owner" indexes the owner
+}
+
+type Asset struct{
+	Type string `json:"type"`
+	ID string `json:"id"`
+	Owner string `json:"owner"`
+	Fields map[string]string `json:"fields"`
+}
+
+type AssetDescription struct{
+	Type string `json:"type"`
+	Fields map[string]string `json:"fields,omitempty"`	//field values the asset must have
+}
+
+type AnAssetTrade struct{
+	ID string `json:"id"`						//transaction id of the open
+	User string `json:"user"`					//user who created the open trade order
+	Timestamp int64 `json:"timestamp"`
+	Want AssetDescription `json:"want"`		//description of desired asset
+	Willing []AssetDescription `json:"willing"`	//descriptions of assets willing to trade away
+}
+
+type AllAssetTrades struct{
+	OpenTrades []AnAssetTrade `json:"open_trades"`
+}
+
+// ============================================================================================================================
+// Register Asset Type - admins declare a new kind of asset, its fields and which fields get a lookup list
+// ============================================================================================================================
+func (t *SimpleChaincode) register_asset_type(stub stateStub, args []string) ([]byte, error) {
+	//	0		1			2										3
+	//["admin", "ticket", "event:string:required;row:int:optional", "event,owner"]
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start register asset type")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	name := strings.ToLower(args[1])
+	if len(name) <= 0 || strings.Contains(name, "_") {
+		return nil, errors.New("2nd argument must be a non-empty string without _")
+	}
+	_, err = getAssetType(stub, name)
+	if err == nil {
+		return nil, errors.New("Asset type " + name + " already exists")
+	}
+
+	assetType := AssetType{Name: name, Fields: map[string]AttributeSpec{}}
+	for _, field := range strings.Split(args[2], ";") {
+		parts := strings.Split(field, ":")
+		if len(parts) != 3 || len(parts[0]) == 0 || parts[0] == "owner" {
+			return nil, errors.New("Fields must look like name:type:required;name:type:optional, not " + field)
+		}
+		switch parts[1] {
+		case "string", "int", "bool", "hash":
+		default:
+			return nil, errors.New("Field " + parts[0] + " must be of type string, int, bool or hash")
+		}
+		assetType.Fields[strings.ToLower(parts[0])] = AttributeSpec{Type: parts[1], Required: parts[2] == "required"}
+	}
+	if len(args[3]) > 0 {
+		for _, field := range strings.Split(args[3], ",") {
+			field = strings.ToLower(field)
+			if _, ok := assetType.Fields[field]; !ok && field != "owner" {
+				return nil, errors.New("Cannot index unknown field " + field)
+			}
+			assetType.Indexes = append(assetType.Indexes, field)
+		}
+	}
+
+	jsonAsBytes, _ := json.Marshal(assetType)
+	err = stub.PutState(assetTypePrefix + name, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = addToIndex(stub, assetTypeIndexStr, name)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end register asset type")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Create Asset - admins create an asset of a registered type for a user
+// ============================================================================================================================
+func (t *SimpleChaincode) create_asset(stub stateStub, args []string) ([]byte, error) {
+	//	0		1			2		3		4
+	//["admin", "ticket", "t100", "bob", "event=finals;row=12"]
+	if len(args) != 5 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 5")
+	}
+
+	fmt.Println("- start create asset")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	assetType, err := getAssetType(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if len(args[2]) <= 0 {
+		return nil, errors.New("3rd argument must be a non-empty string")
+	}
+	if len(args[3]) <= 0 || isSystemAccount(args[3]) {
+		return nil, errors.New("4th argument must be a user")
+	}
+	_, err = getAsset(stub, assetType.Name, args[2])
+	if err == nil {
+		return nil, errors.New("This asset already exists")
+	}
+	fields, err := parseAttributes(args[4])
+	if err != nil {
+		return nil, err
+	}
+	err = checkSchema(assetType.Fields, fields, assetType.Name + " assets")
+	if err != nil {
+		return nil, err
+	}
+
+	asset := Asset{Type: assetType.Name, ID: args[2], Owner: strings.ToLower(args[3]), Fields: fields}
+	err = putAsset(stub, asset)
+	if err != nil {
+		return nil, err
+	}
+	err = addToIndex(stub, assetIndexPrefix + asset.Type, asset.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, field := range assetType.Indexes {
+		err = addToIndex(stub, assetLookupKey(asset, field), asset.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("- end create asset")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Transfer Asset - the owner hands an asset to someone else
+// ============================================================================================================================
+func (t *SimpleChaincode) transfer_asset(stub stateStub, args []string) ([]byte, error) {
+	//	0			1		2		3
+	//["ticket", "t100", "bob", "alice"]
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start transfer asset")
+	err := checkActor(stub, args[2])
+	if err != nil {
+		return nil, err
+	}
+	if len(args[3]) <= 0 || isSystemAccount(args[3]) {
+		return nil, errors.New("4th argument must be a user")
+	}
+	asset, err := getAsset(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	if asset.Owner != strings.ToLower(args[2]) {
+		return nil, errors.New(args[2] + " does not own " + asset.Type + " " + asset.ID)
+	}
+	err = moveAsset(stub, asset, args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end transfer asset")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Open Asset Trade - offer assets you have for an asset you want, descriptions may be of any registered type
+// ============================================================================================================================
+func (t *SimpleChaincode) open_asset_trade(stub stateStub, args []string) ([]byte, error) {
+	//	0		1			2				3				4
+	//["bob", "ticket", "event=finals", "collectible", "set=1999"] *"ticket", "event=semis"*
+	if len(args) < 5 || len(args) % 2 == 0 {
+		return nil, errors.New("Incorrect number of arguments. Expecting user and at least 2 type/fields pairs")
+	}
+
+	fmt.Println("- start open asset trade")
+	err := checkActor(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	open := AnAssetTrade{ID: stub.GetTxID(), User: strings.ToLower(args[0])}
+	open.Timestamp, err = txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < len(args); i += 2 {
+		desc, err := parseAssetDescription(stub, args[i], args[i+1])
+		if err != nil {
+			return nil, err
+		}
+		if i == 1 {
+			open.Want = desc
+			continue
+		}
+		if _, err = findAsset4Trade(stub, open.User, desc); err != nil {
+			return nil, errors.New(open.User + " does not own a " + desc.Type + " like that")
+		}
+		open.Willing = append(open.Willing, desc)
+	}
+
+	trades, err := getAssetTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	trades.OpenTrades = append(trades.OpenTrades, open)
+	err = putAssetTrades(stub, trades)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end open asset trade")
+	return []byte(open.ID), nil
+}
+
+// ============================================================================================================================
+// Perform Asset Trade - close an open asset trade, the closer gives an asset matching the want and gets a willing one back
+// ============================================================================================================================
+func (t *SimpleChaincode) perform_asset_trade(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2			3
+	//[trade id, "alice", "ticket", "t100"]
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start perform asset trade")
+	err := checkActor(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	trades, err := getAssetTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	pos := findAssetTrade(trades, args[0])
+	if pos < 0 {
+		return nil, errors.New("Did not find open asset trade " + args[0])
+	}
+	trade := trades.OpenTrades[pos]
+	closer := strings.ToLower(args[1])
+	if closer == trade.User {
+		return nil, errors.New("Cannot close your own trade")
+	}
+
+	closersAsset, err := getAsset(stub, args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+	if closersAsset.Owner != closer {
+		return nil, errors.New(args[1] + " does not own " + closersAsset.Type + " " + closersAsset.ID)
+	}
+	if !matchesAssetDescription(closersAsset, trade.Want) {
+		return nil, errors.New("asset in input does not meet trade requriements")
+	}
+
+	for _, option := range trade.Willing {
+		openersAsset, e := findAsset4Trade(stub, trade.User, option)
+		if e != nil {
+			continue
+		}
+		err = moveAsset(stub, closersAsset, trade.User)						//closer -> opener
+		if err != nil {
+			return nil, err
+		}
+		err = moveAsset(stub, openersAsset, closer)							//opener -> closer
+		if err != nil {
+			return nil, err
+		}
+		trades.OpenTrades = append(trades.OpenTrades[:pos], trades.OpenTrades[pos+1:]...)
+		err = putAssetTrades(stub, trades)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("- end perform asset trade")
+		return nil, nil
+	}
+	return nil, errors.New("Opener no longer owns anything they were willing to trade")
+}
+
+// ============================================================================================================================
+// Remove Asset Trade - the opener cancels an open asset trade
+// ============================================================================================================================
+func (t *SimpleChaincode) remove_asset_trade(stub stateStub, args []string) ([]byte, error) {
+	//	0			1
+	//[trade id, "bob"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	err := checkActor(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	trades, err := getAssetTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	pos := findAssetTrade(trades, args[0])
+	if pos < 0 {
+		return nil, errors.New("Did not find open asset trade " + args[0])
+	}
+	if trades.OpenTrades[pos].User != strings.ToLower(args[1]) {
+		return nil, errors.New("Only the opener of a trade can remove it")
+	}
+	trades.OpenTrades = append(trades.OpenTrades[:pos], trades.OpenTrades[pos+1:]...)
+	return nil, putAssetTrades(stub, trades)
+}
+
+// ============================================================================================================================
+// Read Asset - read one asset
+// ============================================================================================================================
+func (t *SimpleChaincode) read_asset(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+	asset, err := getAsset(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(asset)
+}
+
+// ============================================================================================================================
+// List Assets - every asset of a type, or only those whose field has a value. Indexed fields use their lookup list
+// ============================================================================================================================
+func (t *SimpleChaincode) list_assets(stub stateStub, args []string) ([]byte, error) {
+	//	0			1			2
+	//["ticket", *"event"*, *"finals"*]
+	if len(args) != 1 && len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1 or 3")
+	}
+	assetType, err := getAssetType(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	indexStr := assetIndexPrefix + assetType.Name
+	var field, value string
+	if len(args) == 3 {
+		field = strings.ToLower(args[1])
+		value = args[2]
+		for _, indexed := range assetType.Indexes {
+			if indexed == field {
+				indexStr = assetLookupKey(Asset{Type: assetType.Name, Owner: strings.ToLower(value), Fields: map[string]string{field: value}}, field)
+			}
+		}
+	}
+	indexAsBytes, err := stub.GetState(indexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get asset index")
+	}
+	var index []string
+	json.Unmarshal(indexAsBytes, &index)										//un stringify it aka JSON.parse()
+
+	var assets []Asset
+	for _, id := range index {
+		asset, err := getAsset(stub, assetType.Name, id)
+		if err != nil {
+			return nil, err
+		}
+		if len(field) > 0 && assetField(asset, field) != value && !(field == "owner" && asset.Owner == strings.ToLower(value)) {
+			continue
+		}
+		assets = append(assets, asset)
+	}
+	return json.Marshal(assets)
+}
+
+// ============================================================================================================================
+// Open Asset Trades - every open asset trade
+// ============================================================================================================================
+func (t *SimpleChaincode) open_asset_trades(stub stateStub, args []string) ([]byte, error) {
+	trades, err := getAssetTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(trades)
+}
+
+// ============================================================================================================================
+// cleanAssetTrades - drop willing options the opener can no longer cover, and trades with none left
+// ============================================================================================================================
+func cleanAssetTrades(stub stateStub) error {
+	fmt.Println("- start clean asset trades")
+	trades, err := getAssetTrades(stub)
+	if err != nil {
+		return err
+	}
+	if dropUncovered(&assetTrades{stub: stub, trades: &trades}) {
+		err = putAssetTrades(stub, trades)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("- end clean asset trades")
+	return nil
+}
+
+// ============================================================================================================================
+// moveAsset - change the owner of an asset, keeping the owner lookup list in step
+// ============================================================================================================================
+func moveAsset(stub stateStub, asset Asset, user string) error {
+	assetType, err := getAssetType(stub, asset.Type)
+	if err != nil {
+		return err
+	}
+	indexed := false
+	for _, field := range assetType.Indexes {
+		if field == "owner" {
+			indexed = true
+		}
+	}
+	if indexed {
+		err = removeFromIndex(stub, assetLookupKey(asset, "owner"), asset.ID)
+		if err != nil {
+			return err
+		}
+	}
+	asset.Owner = strings.ToLower(user)
+	err = putAsset(stub, asset)
+	if err != nil {
+		return err
+	}
+	if indexed {
+		return addToIndex(stub, assetLookupKey(asset, "owner"), asset.ID)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// findAsset4Trade - look for an asset this user owns that matches the description
+// ============================================================================================================================
+func findAsset4Trade(stub stateStub, user string, desc AssetDescription) (Asset, error) {
+	var found Asset
+	ok, err := findInIndex(stub, assetIndexPrefix + desc.Type, func(id string) (bool, error) {
+		asset, err := getAsset(stub, desc.Type, id)
+		if err != nil {
+			return false, err
+		}
+		found = asset
+		return asset.Owner == strings.ToLower(user) && matchesAssetDescription(asset, desc), nil
+	})
+	if err != nil {
+		return Asset{}, err
+	}
+	if !ok {
+		return Asset{}, errors.New("Did not find asset to use in this trade")
+	}
+	return found, nil
+}
+
+// ============================================================================================================================
+// parseAssetDescription - build a trade description for a registered type from "field=value;field=value"
+// ============================================================================================================================
+func parseAssetDescription(stub stateStub, typeName string, fields string) (AssetDescription, error) {
+	assetType, err := getAssetType(stub, typeName)
+	if err != nil {
+		return AssetDescription{}, err
+	}
+	desc := AssetDescription{Type: assetType.Name}
+	desc.Fields, err = parseAttributes(fields)
+	if err != nil {
+		return desc, err
+	}
+	for name := range desc.Fields {
+		if _, ok := assetType.Fields[name]; !ok {
+			return desc, errors.New(assetType.Name + " assets do not have a " + name + " field")
+		}
+	}
+	return desc, nil
+}
+
+// ============================================================================================================================
+// matchesAssetDescription - true if the asset is of the type and has every field value the description asks for
+// ============================================================================================================================
+func matchesAssetDescription(asset Asset, desc AssetDescription) bool {
+	if asset.Type != desc.Type {
+		return false
+	}
+	for name, value := range desc.Fields {
+		if asset.Fields[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ============================================================================================================================
+// assetField - value of a field, "owner" is the owner
+// ============================================================================================================================
+func assetField(asset Asset, field string) string {
+	if field == "owner" {
+		return asset.Owner
+	}
+	return asset.Fields[field]
+}
+
+// ============================================================================================================================
+// assetLookupKey - key of the lookup list an asset belongs to for an indexed field
+// ============================================================================================================================
+func assetLookupKey(asset Asset, field string) string {
+	return assetLookupPrefix + asset.Type + "_" + field + "_" + assetField(asset, field)
+}
+
+// ============================================================================================================================
+// findAssetTrade - position of the open asset trade with this id, -1 if it is not there
+// ============================================================================================================================
+func findAssetTrade(trades AllAssetTrades, id string) int {
+	for i := range trades.OpenTrades {
+		if trades.OpenTrades[i].ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// ============================================================================================================================
+// getAssetType - read a registered asset type
+// ============================================================================================================================
+func getAssetType(stub stateStub, name string) (AssetType, error) {
+	assetType := AssetType{}
+	name = strings.ToLower(name)
+	typeAsBytes, err := stub.GetState(assetTypePrefix + name)
+	if err != nil {
+		return assetType, errors.New("Failed to get asset type")
+	}
+	json.Unmarshal(typeAsBytes, &assetType)									//un stringify it aka JSON.parse()
+	if assetType.Name != name {
+		return assetType, errors.New("Did not find asset type " + name)
+	}
+	return assetType, nil
+}
+
+// ============================================================================================================================
+// getAsset - read an asset by type and id
+// ============================================================================================================================
+func getAsset(stub stateStub, typeName string, id string) (Asset, error) {
+	asset := Asset{}
+	typeName = strings.ToLower(typeName)
+	assetAsBytes, err := stub.GetState(assetPrefix + typeName + "_" + id)
+	if err != nil {
+		return asset, errors.New("Failed to get asset")
+	}
+	json.Unmarshal(assetAsBytes, &asset)										//un stringify it aka JSON.parse()
+	if asset.Type != typeName || asset.ID != id {
+		return asset, errors.New("Did not find " + typeName + " " + id)
+	}
+	return asset, nil
+}
+
+// ============================================================================================================================
+// putAsset - rewrite an asset
+// ============================================================================================================================
+func putAsset(stub stateStub, asset Asset) error {
+	jsonAsBytes, _ := json.Marshal(asset)
+	return stub.PutState(assetPrefix + asset.Type + "_" + asset.ID, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// getAssetTrades - read all open asset trades
+// ============================================================================================================================
+func getAssetTrades(stub stateStub) (AllAssetTrades, error) {
+	var trades AllAssetTrades
+	tradesAsBytes, err := stub.GetState(assetTradesStr)
+	if err != nil {
+		return trades, errors.New("Failed to get asset trades")
+	}
+	json.Unmarshal(tradesAsBytes, &trades)										//un stringify it aka JSON.parse()
+	return trades, nil
+}
+
+// ============================================================================================================================
+// putAssetTrades - rewrite all open asset trades
+// ============================================================================================================================
+func putAssetTrades(stub stateStub, trades AllAssetTrades) error {
+	jsonAsBytes, _ := json.Marshal(trades)
+	return stub.PutState(assetTradesStr, jsonAsBytes)
+}
@@ -0,0 +1,95 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestAssetTradeSwapsOwners(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	l.must("register_asset_type", "admin", "ticket", "event:string:required", "event,owner")
+	l.must("create_asset", "admin", "ticket", "t1", "bob", "event=finals")
+	l.must("create_asset", "admin", "ticket", "t2", "alice", "event=semis")
+	l.fails("must be a user", "create_asset", "admin", "ticket", "t3", "_escrow", "event=finals")
+
+	l.as("bob")
+	res := l.Run("invoke", "open_asset_trade", []string{"bob", "ticket", "event=semis", "ticket", "event=finals"})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	l.as("alice")
+	l.must("perform_asset_trade", string(res.Payload), "alice", "ticket", "t2")
+
+	var asset Asset
+	l.query(&asset, "read_asset", "ticket", "t1")
+	if asset.Owner != "alice" {
+		t.Fatalf("t1 is owned by %s, want alice", asset.Owner)
+	}
+	l.query(&asset, "read_asset", "ticket", "t2")
+	if asset.Owner != "bob" {
+		t.Fatalf("t2 is owned by %s, want bob", asset.Owner)
+	}
+}
+
+func TestSystemAccountsCannotMoveAssets(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	l.must("register_asset_type", "admin", "ticket", "event:string:required", "owner")
+	l.must("create_asset", "admin", "ticket", "t1", "bob", "event=finals")
+	l.fails("system account", "transfer_asset", "ticket", "t1", "_escrow", "bob")
+	l.fails("must be a user", "transfer_asset", "ticket", "t1", "bob", "abc")
+	l.fails("system account", "open_asset_trade", "_escrow", "ticket", "event=semis", "ticket", "event=finals")
+}
+
+func TestOnlyAdminsCreateAssets(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	l.must("register_asset_type", "admin", "ticket", "event:string:required", "owner")
+	l.as("eve")
+	l.fails("Only an admin", "create_asset", "eve", "ticket", "t1", "eve", "event=finals")
+	l.fails("The caller is not admin", "create_asset", "admin", "ticket", "t1", "eve", "event=finals")
+	if res := l.Run("query", "read_asset", []string{"ticket", "t1"}); res.Err == nil {
+		t.Fatal("eve created a ticket")
+	}
+}
+
+func TestAssetTradesDropOptionsTheOpenerGaveAway(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	l.must("register_asset_type", "admin", "ticket", "event:string:required", "owner")
+	l.must("create_asset", "admin", "ticket", "t1", "bob", "event=finals")
+	l.must("create_asset", "admin", "ticket", "t2", "bob", "event=quarters")
+
+	l.as("bob")
+	l.must("open_asset_trade", "bob", "ticket", "event=semis", "ticket", "event=finals", "ticket", "event=quarters")
+	l.must("transfer_asset", "ticket", "t1", "bob", "carol")
+	var trades AllAssetTrades
+	l.query(&trades, "open_asset_trades")
+	if len(trades.OpenTrades) != 1 || len(trades.OpenTrades[0].Willing) != 1 || trades.OpenTrades[0].Willing[0].Fields["event"] != "quarters" {
+		t.Fatalf("open trades %+v, want only the quarters option left", trades.OpenTrades)
+	}
+	l.must("transfer_asset", "ticket", "t2", "bob", "carol")
+	l.query(&trades, "open_asset_trades")
+	if len(trades.OpenTrades) != 0 {
+		t.Fatalf("open trades %+v, want none once bob gave both away", trades.OpenTrades)
+	}
+}
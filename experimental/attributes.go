@@ -0,0 +1,250 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+type AttributeSpec struct{
+	Type string `json:"type"`					//"string", "int", "bool" or "hash"
+	Required bool `json:"required"`
+}
+
+// ============================================================================================================================
+// Set Attribute Schema - admins declare which attributes marbles of a collection may carry
+// ============================================================================================================================
+func (t *SimpleChaincode) set_attribute_schema(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2			3		4
+	//["admin", "blue", "rarity", "string", "required"]   - "optional", or "remove" to drop the attribute
+	if len(args) != 5 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 5")
+	}
+
+	fmt.Println("- start set attribute schema")
+	collection, err := adminCollection(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	attr := strings.ToLower(args[2])
+	if len(attr) <= 0 || strings.ContainsAny(attr, "=;") {
+		return nil, errors.New("3rd argument must be a non-empty string without = or ;")
+	}
+	switch args[3] {
+	case "string", "int", "bool", "hash":
+	default:
+		return nil, errors.New("4th argument must be string, int, bool or hash")
+	}
+	if collection.Schema == nil {
+		collection.Schema = map[string]AttributeSpec{}
+	}
+	switch args[4] {
+	case "required", "optional":
+		collection.Schema[attr] = AttributeSpec{Type: args[3], Required: args[4] == "required"}
+	case "remove":
+		delete(collection.Schema, attr)
+	default:
+		return nil, errors.New("5th argument must be required, optional or remove")
+	}
+	err = putCollection(stub, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set attribute schema")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Marbles By Attribute - live marbles whose attribute has this value, optionally of one color
+// ============================================================================================================================
+func (t *SimpleChaincode) marbles_by_attribute(stub stateStub, args []string) ([]byte, error) {
+	//	0			1		2
+	//["rarity", "rare", *"blue"*]
+	if len(args) != 2 && len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2 or 3")
+	}
+
+	marblesAsBytes, err := stub.GetState(marbleIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get marble index")
+	}
+	var marbleIndex []string
+	json.Unmarshal(marblesAsBytes, &marbleIndex)								//un stringify it aka JSON.parse()
+
+	attr := strings.ToLower(args[0])
+	var found []Marble
+	for _, name := range marbleIndex {
+		marbleAsBytes, err := stub.GetState(name)
+		if err != nil {
+			return nil, errors.New("Failed to get marble")
+		}
+		res := Marble{}
+		json.Unmarshal(marbleAsBytes, &res)									//un stringify it aka JSON.parse()
+		if res.Attributes[attr] != args[1] {
+			continue
+		}
+		if len(args) == 3 && res.Color != strings.ToLower(args[2]) {
+			continue
+		}
+		found = append(found, res)
+	}
+	return json.Marshal(found)
+}
+
+// ============================================================================================================================
+// parseAttributes - turn "rarity=rare;pattern=swirl" into a map, an empty string has no attributes
+// ============================================================================================================================
+func parseAttributes(str string) (map[string]string, error) {
+	if len(str) == 0 {
+		return nil, nil
+	}
+	attrs := map[string]string{}
+	for _, pair := range strings.Split(str, ";") {
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, errors.New("Attributes must look like name=value;name=value, not " + str)
+		}
+		attrs[strings.ToLower(kv[0])] = kv[1]
+	}
+	return attrs, nil
+}
+
+// ============================================================================================================================
+// parseDescription - build a trade description, the color may carry attribute constraints like "blue;rarity=rare"
+// ============================================================================================================================
+func parseDescription(color string, size string) (Description, error) {
+	var desc Description
+	var err error
+	desc.Size, err = strconv.Atoi(size)
+	if err != nil {
+		return desc, errors.New("is not a numeric string " + size)
+	}
+	parts := strings.SplitN(color, ";", 2)
+	desc.Color = parts[0]
+	if len(parts) == 2 {
+		desc.Attributes, err = parseAttributes(parts[1])
+	}
+	return desc, err
+}
+
+// ============================================================================================================================
+// checkAttributes - make sure attributes follow the schema of the collection for this color
+// ============================================================================================================================
+func checkAttributes(stub stateStub, color string, attrs map[string]string) error {
+	collection, isNew, err := getCollection(stub, color)
+	if err != nil {
+		return err
+	}
+	if isNew || len(collection.Schema) == 0 {									//no schema, anything goes
+		return nil
+	}
+	return checkSchema(collection.Schema, attrs, color + " marbles")
+}
+
+// ============================================================================================================================
+// checkSchema - make sure every attribute is declared and typed right, and every required attribute is there
+// ============================================================================================================================
+func checkSchema(schema map[string]AttributeSpec, attrs map[string]string, what string) error {
+	var err error
+	for name, value := range attrs {
+		spec, ok := schema[name]
+		if !ok {
+			return errors.New(what + " do not have a " + name + " attribute")
+		}
+		switch spec.Type {
+		case "int":
+			_, err = strconv.Atoi(value)
+		case "bool":
+			_, err = strconv.ParseBool(value)
+		case "hash":
+			_, err = hex.DecodeString(value)
+		}
+		if err != nil {
+			return errors.New("Attribute " + name + " must be of type " + spec.Type)
+		}
+	}
+	for name, spec := range schema {
+		if _, ok := attrs[name]; spec.Required && !ok {
+			return errors.New(what + " require a " + name + " attribute")
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// matchesDescription - true if the marble has the color, size and every attribute the description asks for
+// ============================================================================================================================
+func matchesDescription(res Marble, desc Description) bool {
+	if strings.ToLower(res.Color) != strings.ToLower(desc.Color) || res.Size != desc.Size {
+		return false
+	}
+	for name, value := range desc.Attributes {
+		if res.Attributes[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ============================================================================================================================
+// sameDescription - true if two descriptions ask for exactly the same marble
+// ============================================================================================================================
+func sameDescription(a Description, b Description) bool {
+	return strings.ToLower(a.Color) == strings.ToLower(b.Color) && a.Size == b.Size && sameAttributes(a.Attributes, b.Attributes)
+}
+
+// ============================================================================================================================
+// sameAttributes - true if two attribute maps hold the same values
+// ============================================================================================================================
+func sameAttributes(a map[string]string, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		if other, ok := b[name]; !ok || other != value {
+			return false
+		}
+	}
+	return true
+}
+
+// ============================================================================================================================
+// combineDescriptions - a description that satisfies both, nil attributes of either are ignored
+// ============================================================================================================================
+func combineDescriptions(a Description, b Description) (Description, bool) {
+	combined := Description{Color: a.Color, Size: a.Size, Attributes: map[string]string{}}
+	for name, value := range a.Attributes {
+		combined.Attributes[name] = value
+	}
+	for name, value := range b.Attributes {
+		if other, ok := combined.Attributes[name]; ok && other != value {
+			return combined, false												//they ask for different values
+		}
+		combined.Attributes[name] = value
+	}
+	return combined, true
+}
@@ -0,0 +1,520 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"encoding/hex"
+	"crypto/sha256"
+	"strings"
+)
+
+var auctionIndexStr = "_auctionindex"		//name for the key/value that will store a list of all auction ids
+var auctionPrefix = "_auction_"				//prefix for the key/value that stores an auction
+var bidPrefix = "_bid_"						//prefix for the key/value that stores one bidder's bid on an auction
+var escrowStr = "_escrow"					//holds marbles up for auction and the tokens bid on them
+
+type Auction struct{
+	ID string `json:"id"`						//tx id of start_auction
+	Marble string `json:"marble"`
+	Seller string `json:"seller"`
+	Kind string `json:"kind"`					//"english" or "sealed"
+	Reserve int `json:"reserve"`				//lowest price the seller will take
+	BidEnd int64 `json:"bid_end"`				//tx time in seconds when bidding stops
+	RevealEnd int64 `json:"reveal_end"`		//tx time in seconds when sealed bids can no longer be revealed
+	Bidders []string `json:"bidders"`			//everyone with a bid key on this auction
+	HighBidder string `json:"high_bidder"`
+	HighBid int `json:"high_bid"`
+	Status string `json:"status"`				//"open" or "closed"
+}
+
+type Bid struct{
+	Bidder string `json:"bidder"`
+	Amount int `json:"amount"`				//english bids and revealed sealed bids
+	Commit string `json:"commit"`				//sealed bids - hex sha256 of "amount:salt"
+	Deposit int `json:"deposit"`				//sealed bids - tokens escrowed to cover the revealed amount
+	Revealed bool `json:"revealed"`
+	Timestamp int64 `json:"timestamp"`			//tx time in seconds the bid was last changed
+}
+
+type AuctionClosed struct{
+	Auction Auction `json:"auction"`
+	Fees []FeeCharge `json:"fees"`
+}
+
+type AuctionDetails struct{
+	Auction Auction `json:"auction"`
+	Bids []Bid `json:"bids"`
+}
+
+// ============================================================================================================================
+// Start Auction - put a marble you own into escrow and open it for bids
+// ============================================================================================================================
+func (t *SimpleChaincode) start_auction(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0		1		2			3		4			5
+	//["bob", "asdf", "english", "10", "3600"]
+	//["bob", "asdf", "sealed", "10", "3600", "600"]   - bidding seconds, then reveal seconds
+	if len(args) < 5 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 5 or 6")
+	}
+
+	fmt.Println("- start start auction")
+	err = checkActor(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	auction := Auction{}
+	auction.ID = stub.GetTxID()
+	auction.Marble = args[1]
+	auction.Seller = strings.ToLower(args[0])
+	auction.Kind = args[2]
+	auction.Status = "open"
+	if auction.Kind != "english" && auction.Kind != "sealed" {
+		return nil, errors.New("3rd argument must be english or sealed")
+	}
+	if auction.Kind == "sealed" && len(args) != 6 {
+		return nil, errors.New("Incorrect number of arguments. Sealed auctions expect 6")
+	}
+	auction.Reserve, err = strconv.Atoi(args[3])
+	if err != nil || auction.Reserve < 0 {
+		return nil, errors.New("4th argument must be a non-negative numeric string")
+	}
+	bidSecs, err := strconv.ParseInt(args[4], 10, 64)
+	if err != nil || bidSecs <= 0 {
+		return nil, errors.New("5th argument must be a positive numeric string")
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	auction.BidEnd = now + bidSecs
+	auction.RevealEnd = auction.BidEnd
+	if auction.Kind == "sealed" {
+		revealSecs, err := strconv.ParseInt(args[5], 10, 64)
+		if err != nil || revealSecs <= 0 {
+			return nil, errors.New("6th argument must be a positive numeric string")
+		}
+		auction.RevealEnd = auction.BidEnd + revealSecs
+	}
+
+	marbleAsBytes, err := stub.GetState(auction.Marble)
+	if err != nil {
+		return nil, errors.New("Failed to get marble")
+	}
+	marble := Marble{}
+	json.Unmarshal(marbleAsBytes, &marble)										//un stringify it aka JSON.parse()
+	if marble.Name != auction.Marble || strings.ToLower(marble.User) != auction.Seller {
+		return nil, errors.New("Only the owner of a marble can auction it")
+	}
+	err = setOwner(stub, marble, escrowStr)									//escrow, no fees since nobody is buying yet
+	if err != nil {
+		return nil, err
+	}
+
+	err = putAuction(stub, auction)
+	if err != nil {
+		return nil, err
+	}
+	indexAsBytes, err := stub.GetState(auctionIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get auction index")
+	}
+	var auctionIndex []string
+	json.Unmarshal(indexAsBytes, &auctionIndex)								//un stringify it aka JSON.parse()
+	auctionIndex = append(auctionIndex, auction.ID)
+	jsonAsBytes, _ := json.Marshal(auctionIndex)
+	err = stub.PutState(auctionIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end start auction " + auction.ID)
+	return []byte(auction.ID), nil
+}
+
+// ============================================================================================================================
+// Place Bid - english bids escrow the amount and refund the bid they beat, sealed bids escrow a deposit behind a commitment
+// ============================================================================================================================
+func (t *SimpleChaincode) place_bid(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0		1			2				3
+	//["alice", auction id, "15"]						- english
+	//["alice", auction id, sha256("15:salt"), "20"]	- sealed, commitment and deposit
+	if len(args) < 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3 or 4")
+	}
+
+	fmt.Println("- start place bid")
+	bidder := strings.ToLower(args[0])
+	err = checkActor(stub, bidder)
+	if err != nil {
+		return nil, err
+	}
+	auction, err := getAuction(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	if auction.Status != "open" || now >= auction.BidEnd {
+		return nil, errors.New("Auction is not taking bids")
+	}
+	if bidder == auction.Seller {
+		return nil, errors.New("Cannot bid on your own auction")
+	}
+	bid, err := getBid(stub, auction.ID, bidder)
+	if err != nil {
+		return nil, err
+	}
+	isNew := len(bid.Bidder) == 0
+	bid.Bidder = bidder
+	bid.Timestamp = now
+
+	if auction.Kind == "english" {
+		amount, err := strconv.Atoi(args[2])
+		if err != nil {
+			return nil, errors.New("3rd argument must be a numeric string")
+		}
+		if amount < auction.Reserve || amount <= auction.HighBid {
+			return nil, errors.New("Bid must meet the reserve and beat " + strconv.Itoa(auction.HighBid))
+		}
+		err = moveTokens(stub, bidder, escrowStr, amount)
+		if err != nil {
+			return nil, err
+		}
+		if len(auction.HighBidder) > 0 {										//give the beaten bid back
+			err = moveTokens(stub, escrowStr, auction.HighBidder, auction.HighBid)
+			if err != nil {
+				return nil, err
+			}
+		}
+		auction.HighBidder = bidder
+		auction.HighBid = amount
+		bid.Amount = amount
+	} else {
+		if len(args) != 4 {
+			return nil, errors.New("Incorrect number of arguments. Sealed bids expect 4")
+		}
+		if !isNew {
+			return nil, errors.New("Sealed bids cannot be changed once placed")
+		}
+		deposit, err := strconv.Atoi(args[3])
+		if err != nil || deposit < auction.Reserve {
+			return nil, errors.New("4th argument must be a numeric string that meets the reserve")
+		}
+		err = moveTokens(stub, bidder, escrowStr, deposit)
+		if err != nil {
+			return nil, err
+		}
+		bid.Commit = strings.ToLower(args[2])
+		bid.Deposit = deposit
+	}
+
+	if isNew {
+		auction.Bidders = append(auction.Bidders, bidder)
+	}
+	err = putBid(stub, auction.ID, bid)
+	if err != nil {
+		return nil, err
+	}
+	err = putAuction(stub, auction)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end place bid")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Reveal Bid - open a sealed bid once bidding has ended, the amount and salt must hash to the commitment
+// ============================================================================================================================
+func (t *SimpleChaincode) reveal_bid(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0		1			2		3
+	//["alice", auction id, "15", "salt"]
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start reveal bid")
+	bidder := strings.ToLower(args[0])
+	err = checkActor(stub, bidder)
+	if err != nil {
+		return nil, err
+	}
+	auction, err := getAuction(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	if auction.Kind != "sealed" || auction.Status != "open" || now < auction.BidEnd || now >= auction.RevealEnd {
+		return nil, errors.New("Auction is not taking reveals")
+	}
+	bid, err := getBid(stub, auction.ID, bidder)
+	if err != nil {
+		return nil, err
+	}
+	if len(bid.Bidder) == 0 || bid.Revealed {
+		return nil, errors.New("No sealed bid to reveal for " + bidder)
+	}
+	amount, err := strconv.Atoi(args[2])
+	if err != nil {
+		return nil, errors.New("3rd argument must be a numeric string")
+	}
+	if sealBid(args[2], args[3]) != bid.Commit {
+		return nil, errors.New("Amount and salt do not match the sealed bid")
+	}
+	if amount > bid.Deposit || amount < auction.Reserve {
+		return nil, errors.New("Revealed amount must meet the reserve and be covered by the deposit")
+	}
+	bid.Amount = amount
+	bid.Revealed = true
+	bid.Timestamp = now
+	if amount > auction.HighBid {												//first to reveal wins a tie
+		auction.HighBidder = bidder
+		auction.HighBid = amount
+	}
+
+	err = putBid(stub, auction.ID, bid)
+	if err != nil {
+		return nil, err
+	}
+	err = putAuction(stub, auction)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end reveal bid")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Close Auction - after bidding (and revealing) ends pay the fees and the seller out of the winning bid, refund everyone else
+// and hand over the marble
+// ============================================================================================================================
+func (t *SimpleChaincode) close_auction(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0
+	//[auction id]
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	fmt.Println("- start close auction")
+	auction, err := getAuction(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	if auction.Status != "open" || now < auction.RevealEnd {
+		return nil, errors.New("Auction cannot be closed yet")
+	}
+
+	if auction.Kind == "sealed" {												//give back every deposit but what the winner owes
+		for _, bidder := range auction.Bidders {
+			bid, err := getBid(stub, auction.ID, bidder)
+			if err != nil {
+				return nil, err
+			}
+			refund := bid.Deposit
+			if bidder == auction.HighBidder {
+				refund = bid.Deposit - auction.HighBid
+			}
+			if refund > 0 {
+				err = moveTokens(stub, escrowStr, bidder, refund)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	marbleAsBytes, err := stub.GetState(auction.Marble)
+	if err != nil {
+		return nil, errors.New("Failed to get marble")
+	}
+	marble := Marble{}
+	json.Unmarshal(marbleAsBytes, &marble)										//un stringify it aka JSON.parse()
+
+	var fees []FeeCharge
+	if len(auction.HighBidder) > 0 {
+		fees, err = feesFor(stub, marble, auction.HighBidder)
+		if err != nil {
+			return nil, err
+		}
+		proceeds := auction.HighBid
+		for i := range fees {													//the fees come out of the escrowed bid, so closing never needs more tokens
+			if fees[i].Amount > proceeds {
+				fees[i].Amount = proceeds
+			}
+			proceeds -= fees[i].Amount
+			if fees[i].Amount > 0 {
+				err = moveTokens(stub, escrowStr, fees[i].Payee, fees[i].Amount)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+		err = moveTokens(stub, escrowStr, auction.Seller, proceeds)				//pay the seller what is left
+		if err != nil {
+			return nil, err
+		}
+		err = setOwner(stub, marble, auction.HighBidder)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		fmt.Println("! no winning bid, returning marble to seller")
+		err = setOwner(stub, marble, auction.Seller)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	auction.Status = "closed"
+	err = putAuction(stub, auction)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonAsBytes, _ := json.Marshal(AuctionClosed{Auction: auction, Fees: fees})
+	err = stub.SetEvent("auction_closed", jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end close auction")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Read Auction - an auction and every bid placed on it, sealed amounts stay hidden until revealed
+// ============================================================================================================================
+func (t *SimpleChaincode) read_auction(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	auction, err := getAuction(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	details := AuctionDetails{Auction: auction}
+	for _, bidder := range auction.Bidders {
+		bid, err := getBid(stub, auction.ID, bidder)
+		if err != nil {
+			return nil, err
+		}
+		details.Bids = append(details.Bids, bid)
+	}
+	return json.Marshal(details)
+}
+
+// ============================================================================================================================
+// sealBid - the commitment a sealed bidder submits, hex sha256 of "amount:salt"
+// ============================================================================================================================
+func sealBid(amount string, salt string) string {
+	sum := sha256.Sum256([]byte(amount + ":" + salt))
+	return hex.EncodeToString(sum[:])
+}
+
+// ============================================================================================================================
+// setOwner - change the owner of a marble without charging fees, used for escrow
+// ============================================================================================================================
+func setOwner(stub stateStub, marble Marble, user string) error {
+	touchMarble(stub, marble)
+	from := marble.User
+	marble.User = user
+	return putMarble(stub, marble, "transferred", from)
+}
+
+// ============================================================================================================================
+// txTimestamp - seconds since epoch of the transaction, the same on every peer
+// ============================================================================================================================
+func txTimestamp(stub stateStub) (int64, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil || ts == nil {
+		return 0, errors.New("Failed to get transaction timestamp")
+	}
+	return ts.Seconds, nil
+}
+
+// ============================================================================================================================
+// getAuction - read an auction by id
+// ============================================================================================================================
+func getAuction(stub stateStub, id string) (Auction, error) {
+	auction := Auction{}
+	auctionAsBytes, err := stub.GetState(auctionPrefix + id)
+	if err != nil {
+		return auction, errors.New("Failed to get auction")
+	}
+	json.Unmarshal(auctionAsBytes, &auction)									//un stringify it aka JSON.parse()
+	if auction.ID != id {
+		return auction, errors.New("Did not find auction " + id)
+	}
+	return auction, nil
+}
+
+// ============================================================================================================================
+// putAuction - rewrite an auction
+// ============================================================================================================================
+func putAuction(stub stateStub, auction Auction) error {
+	jsonAsBytes, _ := json.Marshal(auction)
+	return stub.PutState(auctionPrefix + auction.ID, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// getBid - read a bidder's bid on an auction, empty if they have not bid
+// ============================================================================================================================
+func getBid(stub stateStub, id string, bidder string) (Bid, error) {
+	bid := Bid{}
+	bidAsBytes, err := stub.GetState(bidPrefix + id + "_" + bidder)
+	if err != nil {
+		return bid, errors.New("Failed to get bid")
+	}
+	json.Unmarshal(bidAsBytes, &bid)											//un stringify it aka JSON.parse()
+	return bid, nil
+}
+
+// ============================================================================================================================
+// putBid - rewrite a bidder's bid on an auction
+// ============================================================================================================================
+func putBid(stub stateStub, id string, bid Bid) error {
+	jsonAsBytes, _ := json.Marshal(bid)
+	return stub.PutState(bidPrefix + id + "_" + bid.Bidder, jsonAsBytes)
+}
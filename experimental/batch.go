@@ -0,0 +1,80 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+)
+
+type BatchOperation struct{
+	Function string `json:"function"`
+	Args []string `json:"args"`
+}
+
+type BatchEvent struct{
+	Op int `json:"op"`							//position of the operation that set it, -1 outside of a batch
+	Name string `json:"name"`
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ============================================================================================================================
+// Batch - run many invocations in one transaction, either all of them are written or none are.
+// Every operation's event is sent, bundled into one "batch" event when there is more than one
+// ============================================================================================================================
+func (t *SimpleChaincode) batch(stub stateStub, args []string) ([]byte, error) {
+	//	0
+	//['[{"function": "init_marble", "args": ["m1", "blue", "35", "bob"]}, {"function": "set_user", "args": ["m1", "alice"]}]']
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	fmt.Println("- start batch")
+	var ops []BatchOperation
+	err := json.Unmarshal([]byte(args[0]), &ops)
+	if err != nil {
+		return nil, errors.New("Expecting a json array of operations")
+	}
+
+	cache := newTxCache(stub)												//every operation shares one view of state
+	var results []string
+	for i, op := range ops {
+		if op.Function == "batch" || op.Function == "init" {
+			return nil, errors.New("Operation " + strconv.Itoa(i) + ": " + op.Function + " cannot run inside a batch")
+		}
+		cache.op = i + 1
+		res, err := t.invoke(cache, op.Function, op.Args)
+		if err != nil {
+			return nil, errors.New("Operation " + strconv.Itoa(i) + " (" + op.Function + ") failed: " + err.Error())
+		}
+		results = append(results, string(res))
+	}
+
+	err = cache.flush()														//nothing failed, write it all
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end batch - " + strconv.Itoa(len(ops)) + " operations")
+	return json.Marshal(results)
+}
@@ -0,0 +1,91 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// batchOf encodes operations the way a client sends them to batch
+func batchOf(t *testing.T, ops ...BatchOperation) string {
+	jsonAsBytes, err := json.Marshal(ops)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(jsonAsBytes)
+}
+
+func TestBatchTradeIDsAreDeterministic(t *testing.T) {
+	ops := batchOf(t,
+		BatchOperation{Function: "init_marble", Args: []string{"m1", "blue", "16", "bob"}},
+		BatchOperation{Function: "open_trade", Args: []string{"bob", "red", "16", "blue", "16"}},
+		BatchOperation{Function: "open_trade", Args: []string{"bob", "green", "16", "blue", "16"}},
+	)
+	var ids [2][]int64
+	for run := range ids {
+		l := newLedger(t)
+		l.as("bob")
+		l.must("batch", ops)
+		var trades AllTrades
+		if err := json.Unmarshal(l.State[openTradesStr], &trades); err != nil {
+			t.Fatal(err)
+		}
+		for _, trade := range trades.OpenTrades {
+			ids[run] = append(ids[run], trade.Timestamp)
+		}
+	}
+	if len(ids[0]) != 2 || ids[0][0] == ids[0][1] {
+		t.Fatalf("trade ids %v, want 2 different ones", ids[0])
+	}
+	if ids[0][0] != ids[1][0] || ids[0][1] != ids[1][1] {
+		t.Fatalf("trade ids %v on one run and %v on the next, want the same", ids[0], ids[1])
+	}
+}
+
+func TestBatchSendsEveryEvent(t *testing.T) {
+	l := newLedger(t)
+	l.as("bob")
+	res := l.Run("invoke", "batch", []string{batchOf(t,
+		BatchOperation{Function: "init_marble", Args: []string{"m1", "blue", "16", "bob"}},
+		BatchOperation{Function: "init_marble", Args: []string{"m2", "blue", "16", "bob"}},
+		BatchOperation{Function: "burn_marble", Args: []string{"m1", "bob"}},
+		BatchOperation{Function: "burn_marble", Args: []string{"m2", "bob"}},
+	)})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	if res.Event == nil || res.Event.Name != "batch" {
+		t.Fatalf("event %+v, want a batch event", res.Event)
+	}
+	var events []BatchEvent
+	if err := json.Unmarshal([]byte(res.Event.Payload), &events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 || events[0].Op != 2 || events[1].Op != 3 || events[0].Name != "marble_burned" {
+		t.Fatalf("events %+v, want marble_burned from operations 2 and 3", events)
+	}
+
+	l.must("init_marble", "m3", "blue", "16", "bob")
+	res = l.Run("invoke", "burn_marble", []string{"m3", "bob"})
+	if res.Err != nil || res.Event == nil || res.Event.Name != "marble_burned" {
+		t.Fatalf("single burn: error %v, event %+v, want marble_burned", res.Err, res.Event)
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"encoding/json"
+	"strings"
+)
+
+var burnedIndexStr = "_burnedindex"			//name for the key/value that will store a list of all burned marbles
+var burnedStatus = "burned"
+
+type MarbleBurned struct{
+	Marble string `json:"marble"`
+	Color string `json:"color"`
+	Size int `json:"size"`
+	BurnedBy string `json:"burned_by"`
+	BurnTx string `json:"burn_tx"`
+}
+
+// ============================================================================================================================
+// Burn Marble - the owner takes a marble out of circulation, the record stays behind as a tombstone for auditors
+// ============================================================================================================================
+func (t *SimpleChaincode) burn_marble(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["name", "bob"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start burn marble")
+	name := args[0]
+	user := strings.ToLower(args[1])
+	err := checkActor(stub, user)
+	if err != nil {
+		return nil, err
+	}
+	marbleAsBytes, err := stub.GetState(name)
+	if err != nil {
+		return nil, errors.New("Failed to get marble")
+	}
+	res := Marble{}
+	json.Unmarshal(marbleAsBytes, &res)										//un stringify it aka JSON.parse()
+	if res.Name != name {
+		return nil, errors.New("Did not find marble " + name)
+	}
+	if res.Status == burnedStatus {
+		return nil, errors.New("Marble " + name + " is already burned")
+	}
+	if strings.ToLower(res.User) != user {
+		return nil, errors.New(user + " does not own marble " + name)
+	}
+
+	err = tombstone(stub, &res, user)
+	if err != nil {
+		return nil, err
+	}
+	err = recordBurn(stub, res.Color)
+	if err != nil {
+		return nil, err
+	}
+
+	event := MarbleBurned{Marble: name, Color: res.Color, Size: res.Size, BurnedBy: user, BurnTx: res.BurnTx}
+	jsonAsBytes, _ := json.Marshal(event)
+	err = stub.SetEvent("marble_burned", jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end burn marble")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Burned Marbles - every tombstoned marble, for auditors
+// ============================================================================================================================
+func (t *SimpleChaincode) burned_marbles(stub stateStub, args []string) ([]byte, error) {
+	indexAsBytes, err := stub.GetState(burnedIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get burned index")
+	}
+	var burnedIndex []string
+	json.Unmarshal(indexAsBytes, &burnedIndex)									//un stringify it aka JSON.parse()
+
+	var burned []Marble
+	for _, name := range burnedIndex {
+		marbleAsBytes, err := stub.GetState(name)
+		if err != nil {
+			return nil, errors.New("Failed to get marble")
+		}
+		res := Marble{}
+		json.Unmarshal(marbleAsBytes, &res)									//un stringify it aka JSON.parse()
+		if res.Status != burnedStatus {
+			continue
+		}
+		if len(args) > 0 && res.Color != strings.ToLower(args[0]) {				//optional color filter
+			continue
+		}
+		burned = append(burned, res)
+	}
+	return json.Marshal(burned)
+}
+
+// ============================================================================================================================
+// tombstone - mark a marble burned and move it from the marble index to the burned index
+// ============================================================================================================================
+func tombstone(stub stateStub, res *Marble, user string) error {
+	touchMarble(stub, *res)
+	from := res.User
+	res.Status = burnedStatus													//nobody owns a burned marble
+	res.BurnedBy = user
+	res.BurnTx = stub.GetTxID()
+	res.User = ""
+	err := putMarble(stub, *res, "burned", from)
+	if err != nil {
+		return err
+	}
+
+	err = removeFromIndex(stub, marbleIndexStr, res.Name)						//no longer listed with the live marbles
+	if err != nil {
+		return err
+	}
+	indexAsBytes, err := stub.GetState(burnedIndexStr)
+	if err != nil {
+		return errors.New("Failed to get burned index")
+	}
+	var burnedIndex []string
+	json.Unmarshal(indexAsBytes, &burnedIndex)									//un stringify it aka JSON.parse()
+	burnedIndex = append(burnedIndex, res.Name)
+	jsonAsBytes, _ := json.Marshal(burnedIndex)
+	return stub.PutState(burnedIndexStr, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// removeFromIndex - take a name out of a json list of names
+// ============================================================================================================================
+func removeFromIndex(stub stateStub, indexStr string, name string) error {
+	indexAsBytes, err := stub.GetState(indexStr)
+	if err != nil {
+		return errors.New("Failed to get " + indexStr)
+	}
+	var index []string
+	json.Unmarshal(indexAsBytes, &index)										//un stringify it aka JSON.parse()
+	for i := range index {
+		if index[i] == name {
+			index = append(index[:i], index[i+1:]...)
+			jsonAsBytes, _ := json.Marshal(index)
+			return stub.PutState(indexStr, jsonAsBytes)
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// addToIndex - append a name to a json list of names, names already there are left alone
+// ============================================================================================================================
+func addToIndex(stub stateStub, indexStr string, name string) error {
+	indexAsBytes, err := stub.GetState(indexStr)
+	if err != nil {
+		return errors.New("Failed to get " + indexStr)
+	}
+	var index []string
+	json.Unmarshal(indexAsBytes, &index)										//un stringify it aka JSON.parse()
+	for _, val := range index {
+		if val == name {
+			return nil
+		}
+	}
+	index = append(index, name)
+	jsonAsBytes, _ := json.Marshal(index)
+	return stub.PutState(indexStr, jsonAsBytes)
+}
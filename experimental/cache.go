@@ -0,0 +1,169 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// stateStub is the part of the shim every handler uses, a *shim.ChaincodeStub or a txCache over one
+type stateStub interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+	DelState(key string) error
+	GetTxID() string
+	GetTxTimestamp() (*timestamp.Timestamp, error)
+	SetEvent(name string, payload []byte) error
+	GetCallerCertificate() ([]byte, error)
+}
+
+type cacheEntry struct{
+	value []byte
+	deleted bool
+	dirty bool								//written since it was read, flush must send it on
+}
+
+// txCache serves repeated reads from memory and holds writes until flush, so a failed invocation writes nothing
+type txCache struct{
+	stateStub
+	entries map[string]*cacheEntry
+	events []BatchEvent						//one per operation, a single invocation keeps only its last
+	op int									//position in a batch, 0 outside of one
+	touched map[string]bool					//owner/color/size buckets a marble left since the last cleanTrades
+	touchedAll bool							//something changed that buckets cannot describe, clean everything
+}
+
+// ============================================================================================================================
+// newTxCache - start an empty cache over a stub
+// ============================================================================================================================
+func newTxCache(stub stateStub) *txCache {
+	return &txCache{stateStub: stub, entries: map[string]*cacheEntry{}, touched: map[string]bool{}}
+}
+
+// ============================================================================================================================
+// GetState - read from the cache, falling back to the stub the first time a key is seen
+// ============================================================================================================================
+func (c *txCache) GetState(key string) ([]byte, error) {
+	if entry, ok := c.entries[key]; ok {
+		return entry.value, nil
+	}
+	value, err := c.stateStub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[key] = &cacheEntry{value: value}
+	return value, nil
+}
+
+// ============================================================================================================================
+// PutState - remember a write, only the last write to a key reaches the stub
+// ============================================================================================================================
+func (c *txCache) PutState(key string, value []byte) error {
+	c.entries[key] = &cacheEntry{value: value, dirty: true}
+	return nil
+}
+
+// ============================================================================================================================
+// DelState - remember a delete, reads see the key as empty until flush
+// ============================================================================================================================
+func (c *txCache) DelState(key string) error {
+	c.entries[key] = &cacheEntry{deleted: true, dirty: true}
+	return nil
+}
+
+// ============================================================================================================================
+// GetTxID - operations in a batch each get their own id, so records keyed by it do not collide
+// ============================================================================================================================
+func (c *txCache) GetTxID() string {
+	if c.op > 0 {
+		return c.stateStub.GetTxID() + "." + strconv.Itoa(c.op)
+	}
+	return c.stateStub.GetTxID()
+}
+
+// ============================================================================================================================
+// GetTxTimestamp - operations in a batch are a millisecond apart, so trade ids made from it do not collide
+// ============================================================================================================================
+func (c *txCache) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	ts, err := c.stateStub.GetTxTimestamp()
+	if err != nil || ts == nil || c.op == 0 {
+		return ts, err
+	}
+	nanos := int64(ts.Nanos) + int64(c.op) * 1000000
+	return &timestamp.Timestamp{Seconds: ts.Seconds + nanos / 1000000000, Nanos: int32(nanos % 1000000000)}, nil
+}
+
+// ============================================================================================================================
+// SetEvent - hold the event until flush, each operation of a batch keeps its last event
+// ============================================================================================================================
+func (c *txCache) SetEvent(name string, payload []byte) error {
+	event := BatchEvent{Op: c.op - 1, Name: name, Payload: payload}
+	if n := len(c.events); n > 0 && c.events[n-1].Op == event.Op {
+		c.events[n-1] = event
+	} else {
+		c.events = append(c.events, event)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// flush - send every write and the event on to the stub, in key order so each peer writes the same way.
+// The shim keeps one event per transaction, so a batch whose operations set several sends them all as one "batch" event
+// ============================================================================================================================
+func (c *txCache) flush() error {
+	var keys []string
+	for key, entry := range c.entries {
+		if entry.dirty {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry := c.entries[key]
+		var err error
+		if entry.deleted {
+			err = c.stateStub.DelState(key)
+		} else {
+			err = c.stateStub.PutState(key, entry.value)
+		}
+		if err != nil {
+			return err
+		}
+		entry.dirty = false
+	}
+	events := c.events
+	c.events = nil
+	if len(events) == 1 {
+		return c.stateStub.SetEvent(events[0].Name, events[0].Payload)
+	}
+	if len(events) > 1 {
+		jsonAsBytes, err := json.Marshal(events)
+		if err != nil {
+			return err
+		}
+		return c.stateStub.SetEvent("batch", jsonAsBytes)
+	}
+	return nil
+}
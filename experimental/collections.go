@@ -0,0 +1,357 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"strings"
+)
+
+var collectionIndexStr = "_collectionindex"	//name for the key/value that will store a list of all collection colors
+var collectionPrefix = "_collection_"		//prefix for the key/value that stores a collection
+
+type Collection struct{
+	Color string `json:"color"`
+	Sizes []int `json:"sizes"`				//sizes that may be minted, empty for any size
+	MaxSupply int `json:"max_supply"`		//most marbles that may be in circulation at once, 0 for no cap
+	Minters []string `json:"minters"`		//users allowed to mint besides admins
+	Minted int `json:"minted"`
+	Burned int `json:"burned"`
+	Schema map[string]AttributeSpec `json:"schema,omitempty"`	//attributes marbles of this color may carry, empty for any
+}
+
+type CollectionStats struct{
+	Color string `json:"color"`
+	MaxSupply int `json:"max_supply"`
+	Minted int `json:"minted"`
+	Burned int `json:"burned"`
+	Circulating int `json:"circulating"`
+}
+
+// ============================================================================================================================
+// Define Collection - admins cap the supply and sizes of a color, colors without a collection can still be minted by anyone
+// ============================================================================================================================
+func (t *SimpleChaincode) define_collection(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2		3
+	//["admin", "blue", "100", "16,35"]   - max supply (0 for no cap), allowed sizes ("*" for any)
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start define collection")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	color := strings.ToLower(args[1])
+	if len(color) <= 0 {
+		return nil, errors.New("2nd argument must be a non-empty string")
+	}
+	maxSupply, err := strconv.Atoi(args[2])
+	if err != nil || maxSupply < 0 {
+		return nil, errors.New("3rd argument must be a non-negative numeric string")
+	}
+	var sizes []int
+	if args[3] != "*" {
+		for _, part := range strings.Split(args[3], ",") {
+			size, err := strconv.Atoi(strings.TrimSpace(part))
+			if err != nil {
+				return nil, errors.New("4th argument must be * or a comma separated list of numeric strings")
+			}
+			sizes = append(sizes, size)
+		}
+	}
+
+	collection, isNew, err := getCollection(stub, color)
+	if err != nil {
+		return nil, err
+	}
+	if isNew {																	//marbles minted before the collection count against its cap
+		collection.Minted, err = countLiveMarbles(stub, color)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if maxSupply > 0 && maxSupply < circulating(collection) {
+		return nil, errors.New("Max supply is below the " + strconv.Itoa(circulating(collection)) + " already in circulation")
+	}
+	collection.Sizes = sizes
+	collection.MaxSupply = maxSupply
+	err = putCollection(stub, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	if isNew {
+		indexAsBytes, err := stub.GetState(collectionIndexStr)
+		if err != nil {
+			return nil, errors.New("Failed to get collection index")
+		}
+		var collectionIndex []string
+		json.Unmarshal(indexAsBytes, &collectionIndex)							//un stringify it aka JSON.parse()
+		collectionIndex = append(collectionIndex, color)
+		jsonAsBytes, _ := json.Marshal(collectionIndex)
+		err = stub.PutState(collectionIndexStr, jsonAsBytes)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("- end define collection")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Authorize Minter - admins let a user mint marbles of a collection
+// ============================================================================================================================
+func (t *SimpleChaincode) authorize_minter(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2
+	//["admin", "blue", "bob"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start authorize minter")
+	collection, err := adminCollection(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	minter := strings.ToLower(args[2])
+	if !isMinter(collection, minter) {
+		collection.Minters = append(collection.Minters, minter)
+	}
+	err = putCollection(stub, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end authorize minter")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Revoke Minter - admins stop a user minting marbles of a collection
+// ============================================================================================================================
+func (t *SimpleChaincode) revoke_minter(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2
+	//["admin", "blue", "bob"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start revoke minter")
+	collection, err := adminCollection(stub, args[0], args[1])
+	if err != nil {
+		return nil, err
+	}
+	minter := strings.ToLower(args[2])
+	for i := range collection.Minters {
+		if collection.Minters[i] == minter {
+			collection.Minters = append(collection.Minters[:i], collection.Minters[i+1:]...)
+			break
+		}
+	}
+	err = putCollection(stub, collection)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end revoke minter")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Collection Stats - minted, burned and circulating counts for a color
+// ============================================================================================================================
+func (t *SimpleChaincode) collection_stats(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	collection, isNew, err := getCollection(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if isNew {
+		return nil, errors.New("Did not find collection " + args[0])
+	}
+	stats := CollectionStats{Color: collection.Color, MaxSupply: collection.MaxSupply, Minted: collection.Minted, Burned: collection.Burned, Circulating: circulating(collection)}
+	return json.Marshal(stats)
+}
+
+// ============================================================================================================================
+// checkMint - called by init_marble, enforces the collection for this color and counts the mint
+// ============================================================================================================================
+func checkMint(stub stateStub, color string, size int, minter string) error {
+	collection, isNew, err := getCollection(stub, color)
+	if err != nil {
+		return err
+	}
+	if isNew {																	//no collection, anyone can mint
+		return nil
+	}
+	if !isMinter(collection, minter) && requireAdmin(stub, minter) != nil {
+		return errors.New(minter + " is not allowed to mint " + color + " marbles")
+	}
+	if len(collection.Sizes) > 0 && !hasSize(collection, size) {
+		return errors.New(color + " marbles cannot be minted in size " + strconv.Itoa(size))
+	}
+	if collection.MaxSupply > 0 && circulating(collection) >= collection.MaxSupply {		//burned marbles free up room, same rule as reshapeCollection
+		return errors.New("Only " + strconv.Itoa(collection.MaxSupply) + " " + color + " marbles may be in circulation")
+	}
+	collection.Minted++
+	return putCollection(stub, collection)
+}
+
+// ============================================================================================================================
+// recordBurn - count a marble of this color leaving circulation
+// ============================================================================================================================
+func recordBurn(stub stateStub, color string) error {
+	collection, isNew, err := getCollection(stub, color)
+	if err != nil || isNew {
+		return err
+	}
+	collection.Burned++
+	return putCollection(stub, collection)
+}
+
+// ============================================================================================================================
+// reshapeCollection - called by split_marble and merge_marbles, swaps burned marbles of a color for new ones of these sizes
+// ============================================================================================================================
+func reshapeCollection(stub stateStub, color string, sizes []int, burned int) error {
+	collection, isNew, err := getCollection(stub, color)
+	if err != nil || isNew {
+		return err
+	}
+	for _, size := range sizes {
+		if len(collection.Sizes) > 0 && !hasSize(collection, size) {
+			return errors.New(color + " marbles cannot be made in size " + strconv.Itoa(size))
+		}
+	}
+	if collection.MaxSupply > 0 && circulating(collection) - burned + len(sizes) > collection.MaxSupply {		//the cap holds for what is in circulation
+		return errors.New("Only " + strconv.Itoa(collection.MaxSupply) + " " + color + " marbles may be in circulation")
+	}
+	collection.Minted += len(sizes)
+	collection.Burned += burned
+	return putCollection(stub, collection)
+}
+
+// ============================================================================================================================
+// circulating - marbles of the collection's color that are minted and not burned, what the max supply caps
+// ============================================================================================================================
+func circulating(collection Collection) int {
+	return collection.Minted - collection.Burned
+}
+
+// ============================================================================================================================
+// countLiveMarbles - how many marbles of this color are in the marble index, burned ones have left it
+// ============================================================================================================================
+func countLiveMarbles(stub stateStub, color string) (int, error) {
+	marblesAsBytes, err := stub.GetState(marbleIndexStr)
+	if err != nil {
+		return 0, errors.New("Failed to get marble index")
+	}
+	var marbleIndex []string
+	json.Unmarshal(marblesAsBytes, &marbleIndex)								//un stringify it aka JSON.parse()
+
+	count := 0
+	for _, name := range marbleIndex {
+		marbleAsBytes, err := stub.GetState(name)
+		if err != nil {
+			return 0, errors.New("Failed to get marble " + name)
+		}
+		res := Marble{}
+		json.Unmarshal(marbleAsBytes, &res)									//un stringify it aka JSON.parse()
+		if res.Name == name && strings.ToLower(res.Color) == color {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// ============================================================================================================================
+// hasSize - true if the collection allows this size
+// ============================================================================================================================
+func hasSize(collection Collection, size int) bool {
+	for _, s := range collection.Sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// adminCollection - read an existing collection on behalf of an admin
+// ============================================================================================================================
+func adminCollection(stub stateStub, admin string, color string) (Collection, error) {
+	err := requireAdmin(stub, admin)
+	if err != nil {
+		return Collection{}, err
+	}
+	collection, isNew, err := getCollection(stub, color)
+	if err != nil {
+		return collection, err
+	}
+	if isNew {
+		return collection, errors.New("Did not find collection " + color)
+	}
+	return collection, nil
+}
+
+// ============================================================================================================================
+// isMinter - true if this user was authorized to mint the collection
+// ============================================================================================================================
+func isMinter(collection Collection, user string) bool {
+	for _, minter := range collection.Minters {
+		if minter == strings.ToLower(user) {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// getCollection - read the collection for a color, isNew is true if it has not been defined
+// ============================================================================================================================
+func getCollection(stub stateStub, color string) (collection Collection, isNew bool, err error) {
+	color = strings.ToLower(color)
+	collectionAsBytes, err := stub.GetState(collectionPrefix + color)
+	if err != nil {
+		return collection, false, errors.New("Failed to get collection")
+	}
+	json.Unmarshal(collectionAsBytes, &collection)								//un stringify it aka JSON.parse()
+	if collection.Color != color {
+		return Collection{Color: color}, true, nil
+	}
+	return collection, false, nil
+}
+
+// ============================================================================================================================
+// putCollection - rewrite a collection
+// ============================================================================================================================
+func putCollection(stub stateStub, collection Collection) error {
+	jsonAsBytes, _ := json.Marshal(collection)
+	return stub.PutState(collectionPrefix + collection.Color, jsonAsBytes)
+}
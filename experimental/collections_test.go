@@ -0,0 +1,68 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestMaxSupplyCapsCirculation(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	l.must("define_collection", "admin", "blue", "2", "*")
+	l.must("init_marble", "m1", "blue", "10", "bob", "admin")
+	l.must("init_marble", "m2", "blue", "30", "bob", "admin")
+	l.fails("may be in circulation", "init_marble", "m3", "blue", "10", "bob", "admin")
+
+	l.as("bob")
+	l.fails("may be in circulation", "split_marble", "m2", "bob", "m2a", "10", "m2b", "20")
+	l.must("burn_marble", "m1", "bob")
+	l.as("deployer")
+	l.must("init_marble", "m3", "blue", "10", "bob", "admin")
+
+	var stats CollectionStats
+	l.query(&stats, "collection_stats", "blue")
+	if stats.Minted != 3 || stats.Burned != 1 || stats.Circulating != 2 {
+		t.Fatalf("stats %+v, want 3 minted, 1 burned, 2 circulating", stats)
+	}
+}
+
+func TestCollectionCountsMarblesMintedBeforeIt(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	for _, name := range []string{"m1", "m2", "m3"} {
+		l.must("init_marble", name, "blue", "10", "bob", "admin")
+	}
+	l.fails("already in circulation", "define_collection", "admin", "blue", "1", "*")
+	l.must("define_collection", "admin", "blue", "3", "*")
+	l.fails("may be in circulation", "init_marble", "m4", "blue", "10", "bob", "admin")
+
+	l.as("bob")
+	l.must("burn_marble", "m1", "bob")
+	l.as("deployer")
+	l.must("init_marble", "m4", "blue", "10", "bob", "admin")
+	l.fails("may be in circulation", "init_marble", "m5", "blue", "10", "bob", "admin")
+
+	var stats CollectionStats
+	l.query(&stats, "collection_stats", "blue")
+	if stats.Minted != 4 || stats.Burned != 1 || stats.Circulating != 3 {
+		t.Fatalf("stats %+v, want 4 minted, 1 burned, 3 circulating", stats)
+	}
+}
@@ -0,0 +1,35 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFindCyclesCapsTheRingLength(t *testing.T) {
+	l := newLedger(t)
+	var cycles [][]string
+	l.query(&cycles, "find_cycles", "6")
+	res := l.Run("query", "find_cycles", []string{"7"})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "from 2 to 6") {
+		t.Fatalf("find_cycles 7: got error %v, want it refused", res.Err)
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"strings"
+)
+
+var adminsStr = "_admins"					//name for the key/value that will store the users allowed to change settings
+var feePolicyStr = "_feepolicy"				//name for the key/value that will store the fee policy
+
+type FeePolicy struct{
+	Collector string `json:"collector"`		//user who receives the platform fee
+	PlatformFee int `json:"platform_fee"`	//flat fee paid by the new owner each time a marble changes hands
+	Royalty int `json:"royalty"`			//flat fee paid by the new owner to the marble's minter
+}
+
+type FeeCharge struct{
+	Marble string `json:"marble"`
+	Payer string `json:"payer"`
+	Payee string `json:"payee"`
+	Kind string `json:"kind"`				//"platform" or "royalty"
+	Amount int `json:"amount"`
+}
+
+type TradeFilled struct{
+	Trades []int64 `json:"trades"`			//ids of the open trades that were closed
+	Fees []FeeCharge `json:"fees"`
+}
+
+// ============================================================================================================================
+// Set Fee Policy - admins choose who collects the platform fee and how much the platform and minters earn
+// ============================================================================================================================
+func (t *SimpleChaincode) set_fee_policy(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0		1			2		3
+	//["admin", "collector", "2", "1"]
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start set fee policy")
+	err = requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	policy := FeePolicy{}
+	policy.Collector = strings.ToLower(args[1])
+	policy.PlatformFee, err = strconv.Atoi(args[2])
+	if err != nil || policy.PlatformFee < 0 {
+		return nil, errors.New("3rd argument must be a non-negative numeric string")
+	}
+	policy.Royalty, err = strconv.Atoi(args[3])
+	if err != nil || policy.Royalty < 0 {
+		return nil, errors.New("4th argument must be a non-negative numeric string")
+	}
+	if policy.PlatformFee > 0 && len(policy.Collector) <= 0 {
+		return nil, errors.New("2nd argument must be a non-empty string when charging a platform fee")
+	}
+
+	jsonAsBytes, _ := json.Marshal(policy)
+	err = stub.PutState(feePolicyStr, jsonAsBytes)								//store the new policy
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set fee policy")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// chargeFees - collect the platform fee and minter royalty from the user about to receive this marble
+// ============================================================================================================================
+func chargeFees(stub stateStub, marble Marble, user string) ([]FeeCharge, error) {
+	fees, err := feesFor(stub, marble, user)
+	if err != nil {
+		return nil, err
+	}
+	for _, fee := range fees {
+		fmt.Println("! charging " + fee.Payer + " " + strconv.Itoa(fee.Amount) + " " + fee.Kind + " fee for " + fee.Marble)
+		err = moveTokens(stub, fee.Payer, fee.Payee, fee.Amount)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fees, nil
+}
+
+// ============================================================================================================================
+// giftFees - the fees owed when this user receives this marble, collected from the owner handing it over instead
+// ============================================================================================================================
+func giftFees(stub stateStub, marble Marble, user string) ([]FeeCharge, error) {
+	owed, err := feesFor(stub, marble, user)
+	if err != nil {
+		return nil, err
+	}
+	var fees []FeeCharge
+	for _, fee := range owed {
+		fee.Payer = strings.ToLower(marble.User)
+		if fee.Payer == fee.Payee {												//nobody pays themselves
+			continue
+		}
+		fmt.Println("! charging " + fee.Payer + " " + strconv.Itoa(fee.Amount) + " " + fee.Kind + " fee for " + fee.Marble)
+		err = moveTokens(stub, fee.Payer, fee.Payee, fee.Amount)
+		if err != nil {
+			return nil, err
+		}
+		fees = append(fees, fee)
+	}
+	return fees, nil
+}
+
+// ============================================================================================================================
+// feesFor - the platform fee and minter royalty owed when this user receives this marble, nothing is moved
+// ============================================================================================================================
+func feesFor(stub stateStub, marble Marble, user string) ([]FeeCharge, error) {
+	var fees []FeeCharge
+	payer := strings.ToLower(user)
+	if payer == strings.ToLower(marble.User) {										//not changing hands, nothing to pay
+		return fees, nil
+	}
+
+	policyAsBytes, err := stub.GetState(feePolicyStr)
+	if err != nil {
+		return nil, errors.New("Failed to get fee policy")
+	}
+	policy := FeePolicy{}
+	json.Unmarshal(policyAsBytes, &policy)										//un stringify it aka JSON.parse()
+
+	if policy.PlatformFee > 0 && payer != policy.Collector {
+		fees = append(fees, FeeCharge{Marble: marble.Name, Payer: payer, Payee: policy.Collector, Kind: "platform", Amount: policy.PlatformFee})
+	}
+	minter := strings.ToLower(marble.Minter)
+	if policy.Royalty > 0 && len(minter) > 0 && payer != minter {
+		fees = append(fees, FeeCharge{Marble: marble.Name, Payer: payer, Payee: minter, Kind: "royalty", Amount: policy.Royalty})
+	}
+	return fees, nil
+}
+
+// ============================================================================================================================
+// sendTradeFilled - let listeners know which trades closed and what fees were charged
+// ============================================================================================================================
+func sendTradeFilled(stub stateStub, trades []int64, fees []FeeCharge) error {
+	event := TradeFilled{Trades: trades, Fees: fees}
+	jsonAsBytes, _ := json.Marshal(event)
+	return stub.SetEvent("trade_filled", jsonAsBytes)
+}
+
+// ============================================================================================================================
+// requireAdmin - error unless this user was named an admin when the chaincode was initialized and the caller may act as them
+// ============================================================================================================================
+func requireAdmin(stub stateStub, user string) error {
+	adminsAsBytes, err := stub.GetState(adminsStr)
+	if err != nil {
+		return errors.New("Failed to get admins")
+	}
+	var admins []string
+	json.Unmarshal(adminsAsBytes, &admins)										//un stringify it aka JSON.parse()
+	for _, admin := range admins {
+		if admin == strings.ToLower(user) {
+			return checkCaller(stub, user)
+		}
+	}
+	return errors.New("Only an admin can do that: " + user)
+}
@@ -0,0 +1,87 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"encoding/json"
+)
+
+var historyPrefix = "_history_"				//prefix for the key/value that stores every change of a marble's owner or status
+
+type MarbleChange struct{
+	Event string `json:"event"`				//"minted", "transferred", "burned" or "imported"
+	From string `json:"from"`					//owner before, empty for a new marble
+	To string `json:"to"`						//owner after, empty once burned
+	TxID string `json:"tx_id"`
+	Timestamp int64 `json:"timestamp"`			//tx time in seconds
+}
+
+// ============================================================================================================================
+// Marble History - every change of a marble's owner or status, oldest first. Burned marbles keep theirs
+// ============================================================================================================================
+func (t *SimpleChaincode) marble_history(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting name of the marble to query")
+	}
+
+	history, err := getHistory(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(history)
+}
+
+// ============================================================================================================================
+// putMarble - store a marble and add this change to its history, from is the owner it had before
+// ============================================================================================================================
+func putMarble(stub stateStub, res Marble, event string, from string) error {
+	jsonAsBytes, _ := json.Marshal(res)
+	err := stub.PutState(res.Name, jsonAsBytes)								//store marble with id as key
+	if err != nil {
+		return err
+	}
+
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	history, err := getHistory(stub, res.Name)
+	if err != nil {
+		return err
+	}
+	history = append(history, MarbleChange{Event: event, From: from, To: res.User, TxID: stub.GetTxID(), Timestamp: now})
+	jsonAsBytes, _ = json.Marshal(history)
+	return stub.PutState(historyPrefix + res.Name, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// getHistory - read the changes recorded for a marble
+// ============================================================================================================================
+func getHistory(stub stateStub, name string) ([]MarbleChange, error) {
+	history := []MarbleChange{}
+	historyAsBytes, err := stub.GetState(historyPrefix + name)
+	if err != nil {
+		return nil, errors.New("Failed to get history for " + name)
+	}
+	json.Unmarshal(historyAsBytes, &history)									//un stringify it aka JSON.parse()
+	return history, nil
+}
@@ -0,0 +1,59 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestHistoryOutlivesABurn(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	l.must("init_marble", "m1", "blue", "16", "bob", "admin")
+	l.as("bob")
+	l.must("set_user", "m1", "alice")
+	l.as("alice")
+	l.must("burn_marble", "m1", "alice")
+
+	var history []MarbleChange
+	l.query(&history, "marble_history", "m1")
+	want := []MarbleChange{
+		{Event: "minted", To: "bob"},
+		{Event: "transferred", From: "bob", To: "alice"},
+		{Event: "burned", From: "alice"},
+	}
+	if len(history) != len(want) {
+		t.Fatalf("history %+v, want %d changes", history, len(want))
+	}
+	for i, change := range history {
+		if change.Event != want[i].Event || change.From != want[i].From || change.To != want[i].To || change.TxID == "" {
+			t.Fatalf("change %d is %+v, want %+v", i, change, want[i])
+		}
+	}
+}
+
+func TestHistoryOfAnUnknownMarbleIsEmpty(t *testing.T) {
+	l := newLedger(t)
+	var history []MarbleChange
+	l.query(&history, "marble_history", "nope")
+	if len(history) != 0 {
+		t.Fatalf("history %+v, want none", history)
+	}
+}
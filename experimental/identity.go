@@ -0,0 +1,183 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var identitiesStr = "_identities"			//name for the key/value that will store which caller certificate each user name is bound to
+
+// ============================================================================================================================
+// Register User - bind a user name to the certificate of the caller, from then on only that caller may act as the user
+// ============================================================================================================================
+func (t *SimpleChaincode) register_user(stub stateStub, args []string) ([]byte, error) {
+	//	0
+	//["bob"]
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+	if len(args[0]) <= 0 {
+		return nil, errors.New("1st argument must be a non-empty string")
+	}
+
+	fmt.Println("- start register user")
+	cert := callerCert(stub)
+	if len(cert) <= 0 {
+		return nil, errors.New("The caller has no certificate, turn on security to bind user names")
+	}
+	identities, err := getIdentities(stub)
+	if err != nil {
+		return nil, err
+	}
+	user := strings.ToLower(args[0])
+	if bound, ok := identities[user]; ok && bound != cert {
+		return nil, errors.New(args[0] + " is already registered to another caller")
+	}
+	identities[user] = cert
+	err = putIdentities(stub, identities)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end register user")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// checkCaller - error unless the caller may act as this user. A name bound by register_user (or named an admin
+// at init) needs the certificate it was bound to, a name nobody bound is taken on trust
+// ============================================================================================================================
+func checkCaller(stub stateStub, user string) error {
+	identities, err := getIdentities(stub)
+	if err != nil {
+		return err
+	}
+	bound, ok := identities[strings.ToLower(user)]
+	if !ok {
+		return nil
+	}
+	if callerCert(stub) != bound {
+		return errors.New("The caller is not " + user)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// checkOwner - error unless the caller may act as the owner of something, or holds the certificate of an admin
+// ============================================================================================================================
+func checkOwner(stub stateStub, owner string) error {
+	err := checkCaller(stub, owner)
+	if err == nil {
+		return nil
+	}
+	adminsAsBytes, e := stub.GetState(adminsStr)
+	if e != nil {
+		return errors.New("Failed to get admins")
+	}
+	var admins []string
+	json.Unmarshal(adminsAsBytes, &admins)										//un stringify it aka JSON.parse()
+	identities, e := getIdentities(stub)
+	if e != nil {
+		return e
+	}
+	for _, admin := range admins {
+		if cert, ok := identities[admin]; ok && cert == callerCert(stub) {
+			return nil
+		}
+	}
+	return errors.New("The caller is not " + owner + " or an admin")
+}
+
+// ============================================================================================================================
+// requireAdminCaller - error unless the caller holds the certificate of some admin, used before a reset
+// ============================================================================================================================
+func requireAdminCaller(stub stateStub) error {
+	adminsAsBytes, err := stub.GetState(adminsStr)
+	if err != nil {
+		return errors.New("Failed to get admins")
+	}
+	var admins []string
+	json.Unmarshal(adminsAsBytes, &admins)										//un stringify it aka JSON.parse()
+	identities, err := getIdentities(stub)
+	if err != nil {
+		return err
+	}
+	bound := false
+	for _, admin := range admins {
+		if cert, ok := identities[admin]; ok {
+			bound = true
+			if cert == callerCert(stub) {
+				return nil
+			}
+		}
+	}
+	if bound {
+		return errors.New("Only an admin can do that")
+	}
+	return nil																	//no admin is bound, nothing to check against
+}
+
+// ============================================================================================================================
+// bindAdmins - bind the admins named at init to the certificate of whoever deployed, replacing every older binding
+// ============================================================================================================================
+func bindAdmins(stub stateStub, admins []string) error {
+	identities := map[string]string{}
+	if cert := callerCert(stub); len(cert) > 0 {
+		for _, admin := range admins {
+			identities[admin] = cert
+		}
+	}
+	return putIdentities(stub, identities)
+}
+
+// ============================================================================================================================
+// callerCert - hex of the caller's certificate, empty when the network runs without security
+// ============================================================================================================================
+func callerCert(stub stateStub) string {
+	cert, err := stub.GetCallerCertificate()
+	if err != nil {
+		return ""
+	}
+	return hex.EncodeToString(cert)
+}
+
+func getIdentities(stub stateStub) (map[string]string, error) {
+	identitiesAsBytes, err := stub.GetState(identitiesStr)
+	if err != nil {
+		return nil, errors.New("Failed to get identities")
+	}
+	identities := map[string]string{}
+	json.Unmarshal(identitiesAsBytes, &identities)								//un stringify it aka JSON.parse()
+	if identities == nil {
+		identities = map[string]string{}
+	}
+	return identities, nil
+}
+
+func putIdentities(stub stateStub, identities map[string]string) error {
+	jsonAsBytes, _ := json.Marshal(identities)
+	return stub.PutState(identitiesStr, jsonAsBytes)
+}
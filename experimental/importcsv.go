@@ -0,0 +1,117 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/csv"
+	"encoding/json"
+	"strings"
+)
+
+type CSVRowError struct{
+	Line int `json:"line"`
+	Name string `json:"name"`
+	Error string `json:"error"`
+}
+
+type csvRow struct{
+	Line int								//line of the text the row starts on
+	Fields []string
+	Err error								//the row could not be parsed
+}
+
+type CSVImportReport struct{
+	DryRun bool `json:"dry_run"`
+	Created []string `json:"created"`			//names of the marbles made, or that would be made on a dry run
+	Errors []CSVRowError `json:"errors"`
+}
+
+// ============================================================================================================================
+// Import Marbles CSV - create a marble for each valid row, as an invoke it writes them, as a query it is a dry run
+// ============================================================================================================================
+func (t *SimpleChaincode) import_marbles_csv(stub stateStub, args []string, dryRun bool) ([]byte, error) {
+	//	0
+	//["name,color,size,owner\nasdf,blue,35,bob\n..."]   - optional minter and attributes columns follow, like init_marble
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	fmt.Println("- start import marbles csv")
+	report := CSVImportReport{DryRun: dryRun}
+	for i, row := range csvRows(args[0]) {
+		if row.Err != nil {
+			report.Errors = append(report.Errors, CSVRowError{Line: row.Line, Error: row.Err.Error()})
+			continue
+		}
+		if i == 0 && len(row.Fields) > 2 && strings.ToLower(row.Fields[0]) == "name" {	//header row
+			continue
+		}
+
+		rowCache := newTxCache(stub)											//a bad row leaves nothing behind
+		_, err := t.init_marble(rowCache, row.Fields)
+		if err == nil {
+			err = rowCache.flush()
+		}
+		if err != nil {
+			report.Errors = append(report.Errors, CSVRowError{Line: row.Line, Name: row.Fields[0], Error: err.Error()})
+			continue
+		}
+		report.Created = append(report.Created, row.Fields[0])
+	}
+
+	fmt.Println("- end import marbles csv - " + strconv.Itoa(len(report.Created)) + " created, " + strconv.Itoa(len(report.Errors)) + " errors")
+	return json.Marshal(report)
+}
+
+// ============================================================================================================================
+// csvRows - parse csv text row by row, keeping the line each row starts on. Lines are joined while a quote is left open,
+// so a quoted field may run over several. Blank lines are skipped like the csv reader does
+// ============================================================================================================================
+func csvRows(text string) []csvRow {
+	lines := strings.Split(text, "\n")
+	var rows []csvRow
+	for i := 0; i < len(lines); i++ {
+		start := i
+		record := strings.TrimSuffix(lines[i], "\r")
+		for strings.Count(record, "\"") % 2 == 1 && i + 1 < len(lines) {		//quote still open, the field goes on
+			i++
+			record += "\n" + strings.TrimSuffix(lines[i], "\r")
+		}
+		if len(record) == 0 {
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(record))
+		reader.FieldsPerRecord = -1												//rows are checked one by one by the caller
+		reader.TrimLeadingSpace = true
+		fields, err := reader.Read()
+		row := csvRow{Line: start + 1, Fields: fields, Err: err}
+		if pe, ok := err.(*csv.ParseError); ok {								//its line counts from the start of the row
+			row.Line = start + pe.Line
+			row.Err = pe.Err
+		}
+		rows = append(rows, row)
+	}
+	return rows
+}
@@ -0,0 +1,45 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCSVErrorsNameTheLineTheRowStartsOn(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	text := "name,color,size,owner\n\nm1,blue,16,bob\n\"m\n2\",blue,16,bob\nm3,blue,x,bob\r\nm4,\"blue,16,bob\n"
+	res := l.Run("invoke", "import_marbles_csv", []string{text})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	var report CSVImportReport
+	if err := json.Unmarshal(res.Payload, &report); err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Created) != 2 || report.Created[0] != "m1" || report.Created[1] != "m\n2" {
+		t.Fatalf("created %q, want m1 and the quoted name", report.Created)
+	}
+	if len(report.Errors) != 2 || report.Errors[0].Line != 6 || report.Errors[0].Name != "m3" || report.Errors[1].Line != 7 {
+		t.Fatalf("errors %+v, want m3 on line 6 and the open quote on line 7", report.Errors)
+	}
+}
@@ -0,0 +1,76 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestOnlyTheOwnerOrAnAdminSetsTheUser(t *testing.T) {
+	l := newLedger(t)
+	l.as("alice")
+	l.must("register_user", "alice")
+	l.must("init_marble", "m1", "blue", "16", "alice")
+
+	l.as("eve")
+	l.fails("The caller is not alice or an admin", "set_user", "m1", "eve")
+	l.as("alice")
+	l.must("set_user", "m1", "bob")
+	l.as("deployer")
+	l.must("set_user", "m1", "alice")
+	l.fails("must be a user", "set_user", "m1", "_escrow")
+}
+
+func TestCloserMustOwnTheMarbleTheyGive(t *testing.T) {
+	l := newLedger(t)
+	l.as("bob")
+	l.must("init_marble", "m1", "blue", "16", "bob")
+	l.must("open_trade", "bob", "red", "16", "blue", "16")
+	l.as("alice")
+	l.must("init_marble", "m2", "red", "16", "alice")
+
+	var trades AllTrades
+	l.query(&trades, "read", openTradesStr)
+	id := trades.OpenTrades[0].Timestamp
+	l.as("eve")
+	res := l.Run("invoke", "perform_trade", []string{strconv.FormatInt(id, 10), "eve", "m2", "bob", "blue", "16"})
+	if res.Err == nil || !strings.Contains(res.Err.Error(), "eve does not own m2") {
+		t.Fatalf("eve closed a trade with alice's marble: %v", res.Err)
+	}
+}
+
+func TestGiverPaysTheFeesOfSetUser(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	l.must("set_fee_policy", "admin", "house", "2", "0")
+	l.must("fund_account", "admin", "alice", "10")
+	l.as("alice")
+	l.must("init_marble", "m1", "blue", "16", "alice")
+	l.must("set_user", "m1", "bob")
+
+	if bal := l.balance("alice"); bal != 8 {
+		t.Fatalf("alice holds %d after giving m1 away, want 8", bal)
+	}
+	if bal := l.balance("house"); bal != 2 {
+		t.Fatalf("the collector holds %d, want 2", bal)
+	}
+}
@@ -0,0 +1,82 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/randyramnansingh/marbles-chaincode/sim"
+	"github.com/randyramnansingh/marbles-chaincode/txlog"
+)
+
+// testdata/trades.ndjson was recorded with marblesim -record. It opens, amends and fills a trade,
+// lists a marble and ends with a transfer that fails
+func TestReplayRecordedTrades(t *testing.T) {
+	entries, err := txlog.Read("testdata/trades.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := sim.NewSession("experimental", testChaincode{}, 0) //the clock comes from the log
+	var out strings.Builder
+	if diverged := s.ReplayLog(entries, &out); len(diverged) > 0 {
+		t.Fatalf("%d entries diverged:\n%s", len(diverged), out.String())
+	}
+	if !strings.Contains(string(s.State[openTradesStr]), `"open_trades":[]`) {
+		t.Fatalf("open trades %s, want the recorded trade filled", s.State[openTradesStr])
+	}
+}
+
+func TestReplayReportsChangedOutcomes(t *testing.T) {
+	entries, err := txlog.Read("testdata/trades.ndjson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := &entries[len(entries)-1]
+	last.Result = strings.Replace(last.Result, "1700000007000", "1700000007001", 1)
+	diverged := sim.NewSession("experimental", testChaincode{}, 0).ReplayLog(entries, ioutil.Discard)
+	if len(diverged) != 1 || diverged[0].Index != len(entries) {
+		t.Fatalf("diverged %+v, want only the edited last entry", diverged)
+	}
+}
+
+// noClock is a stub whose transaction has no timestamp
+type noClock struct {
+	*sim.Stub
+}
+
+func (noClock) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return nil, errors.New("no timestamp")
+}
+
+func TestTradesNeedTheTxTime(t *testing.T) {
+	l := newLedger(t)
+	l.must("init_marble", "m1", "blue", "16", "bob")
+	stub := noClock{&sim.Stub{State: l.State}}
+	if _, err := (&SimpleChaincode{}).open_trade(stub, []string{"bob", "red", "16", "blue", "16"}); err == nil {
+		t.Fatal("open_trade made an id without a transaction time")
+	}
+	if _, err := (&SimpleChaincode{}).list_for_sale(stub, []string{"bob", "m1", "25"}); err == nil {
+		t.Fatal("list_for_sale stamped a listing without a transaction time")
+	}
+}
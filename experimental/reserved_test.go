@@ -0,0 +1,72 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestWriteIsForAdminsAndSkipsReservedKeys(t *testing.T) {
+	l := newLedger(t)
+	l.as("eve")
+	l.fails("Only an admin", "write", "eve", "anything", "1")
+	l.fails("The caller is not admin", "write", "admin", "anything", "1")
+	l.as("deployer")
+	l.must("write", "admin", "anything", "1")
+	for _, key := range []string{"_balance_eve", "_admins", "_identities", "abc"} {
+		l.fails("reserved", "write", "admin", key, "999999")
+	}
+}
+
+func TestResetDropsEveryBalance(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	l.must("fund_account", "admin", "bob", "100")
+	l.must("init", "500", "admin")
+	if _, ok := l.State[balanceKey("bob")]; ok {
+		t.Fatal("bob's balance outlived the reset")
+	}
+	if bal := l.balance(reserveStr); bal != 500 {
+		t.Fatalf("the reserve holds %d, want 500", bal)
+	}
+}
+
+func TestMarbleNamesStayOffReservedKeys(t *testing.T) {
+	l := newLedger(t)
+	l.as("deployer")
+	l.fails("Marble names cannot", "init_marble", "_balance_alice", "blue", "16", "alice")
+	l.fails("Marble names cannot", "init_marble", "abc", "blue", "16", "alice")
+	l.must("init_marble", "m1", "blue", "35", "alice")
+	l.as("alice")
+	l.fails("Marble names cannot", "split_marble", "m1", "alice", "_admins", "20", "m2", "15")
+
+	res := l.Run("invoke", "import_marbles_csv", []string{"_balance_alice,blue,16,alice\nm3,blue,16,alice\n"})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	var report CSVImportReport
+	json.Unmarshal(res.Payload, &report)
+	if len(report.Errors) != 1 || len(report.Created) != 1 {
+		t.Fatalf("report %+v, want the reserved name refused and m3 created", report)
+	}
+	l.as("deployer")
+	l.must("fund_account", "admin", "alice", "5")
+}
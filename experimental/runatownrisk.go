@@ -28,6 +28,7 @@ import (
 	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/randyramnansingh/marbles-chaincode/txlog"
 )
 
 // SimpleChaincode example simple Chaincode implementation
@@ -36,17 +37,24 @@ type SimpleChaincode struct {
 
 var marbleIndexStr = "_marbleindex"				//name for the key/value that will store a list of all known marbles
 var openTradesStr = "_opentrades"				//name for the key/value that will store all open trades
+var maxCycleLen = 6								//longest ring find_cycles looks for, the search grows exponentially with it
 
 type Marble struct{
 	Name string `json:"name"`					//the fieldtags are needed to keep case from bouncing around
 	Color string `json:"color"`
 	Size int `json:"size"`
 	User string `json:"user"`
+	Minter string `json:"minter,omitempty"`	//user the marble was created for, earns the royalty when it changes hands
+	Status string `json:"status,omitempty"`	//"burned" once the owner takes it out of circulation
+	BurnedBy string `json:"burned_by,omitempty"`
+	BurnTx string `json:"burn_tx,omitempty"`	//transaction that burned it
+	Attributes map[string]string `json:"attributes,omitempty"`	//extra fields like material or rarity, checked against the collection schema
 }
 
 type Description struct{
 	Color string `json:"color"`
 	Size int `json:"size"`
+	Attributes map[string]string `json:"attributes,omitempty"`	//attribute values the marble must have
 }
 
 type AnOpenTrade struct{
@@ -54,6 +62,15 @@ type AnOpenTrade struct{
 	Timestamp int64 `json:"timestamp"`			//utc timestamp of creation
 	Want Description  `json:"want"`				//description of desired marble
 	Willing []Description `json:"willing"`		//array of marbles willing to trade away
+	Amendments []Amendment `json:"amendments,omitempty"`	//history of edits made by the opener
+}
+
+type Amendment struct{
+	Timestamp int64 `json:"timestamp"`			//utc timestamp of the edit
+	Action string `json:"action"`				//"add_willing", "remove_willing" or "want"
+	Color string `json:"color"`
+	Size int `json:"size"`
+	Attributes map[string]string `json:"attributes,omitempty"`
 }
 
 type AllTrades struct{
@@ -61,24 +78,25 @@ type AllTrades struct{
 }
 
 // ============================================================================================================================
-// Main
+// Init - reset all the things
 // ============================================================================================================================
-func main() {
-	err := shim.Start(new(SimpleChaincode))
-	if err != nil {
-		fmt.Printf("Error starting Simple chaincode: %s", err)
-	}
+func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	res, err := t.reset(stub, args)
+	txlog.Record(stub, "init", function, args, res, err)						//no-op unless MARBLES_TXLOG is set
+	return res, err
 }
 
 // ============================================================================================================================
-// Init - reset all the things
+// reset - write the starting state, also used by the "init" invoke
 // ============================================================================================================================
-func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+func (t *SimpleChaincode) reset(stub stateStub, args []string) ([]byte, error) {
 	var Aval int
 	var err error
 
-	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	//   0       1...
+	// "100", "admin"...   - optional admins may follow the asset holding
+	if len(args) < 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting at least 1")
 	}
 
 	// Initialize the chaincode
@@ -101,8 +119,85 @@ func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args [
 	}
 	
 	var trades AllTrades
-	jsonAsBytes, _ = json.Marshal(trades)								//clear the open trade struct
-	err = stub.PutState(openTradesStr, jsonAsBytes)
+	err = putOpenTrades(stub, trades)								//clear the open trade struct
+	if err != nil {
+		return nil, err
+	}
+	
+	var admins []string
+	for _, admin := range args[1:] {
+		admins = append(admins, strings.ToLower(admin))
+	}
+	jsonAsBytes, _ = json.Marshal(admins)								//store who may change chaincode settings
+	err = stub.PutState(adminsStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = bindAdmins(stub, admins)										//only the deployer's certificate may act as them
+	if err != nil {
+		return nil, err
+	}
+	
+	accounts, err := readIndex(stub, accountIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range accounts {										//the reserve gets every token back, so no balance may outlive the reset
+		err = stub.DelState(balanceKey(user))
+		if err != nil {
+			return nil, err
+		}
+	}
+	jsonAsBytes, _ = json.Marshal(empty)								//clear the account index
+	err = stub.PutState(accountIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(empty)								//clear the asset type index
+	err = stub.PutState(assetTypeIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(AllAssetTrades{})						//clear the open asset trades
+	err = stub.PutState(assetTradesStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(empty)								//clear the burned marble index
+	err = stub.PutState(burnedIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(empty)								//clear the collection index
+	err = stub.PutState(collectionIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(empty)								//clear the auction index
+	err = stub.PutState(auctionIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(AllSales{})							//clear the marbles for sale
+	err = stub.PutState(forSaleStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	err = stub.PutState(totalSupplyStr, []byte(strconv.Itoa(Aval)))		//the reserve starts out holding every token
+	if err != nil {
+		return nil, err
+	}
+	
+	var policy FeePolicy
+	jsonAsBytes, _ = json.Marshal(policy)								//no fees until an admin sets a policy
+	err = stub.PutState(feePolicyStr, jsonAsBytes)
 	if err != nil {
 		return nil, err
 	}
@@ -122,31 +217,148 @@ func (t *SimpleChaincode) Run(stub *shim.ChaincodeStub, function string, args []
 // Invoke - Our entry point for Invocations
 // ============================================================================================================================
 func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	res, err := t.invokeTx(stub, function, args)
+	txlog.Record(stub, "invoke", function, args, res, err)
+	return res, err
+}
+
+// ============================================================================================================================
+// invokeTx - run one invocation as a transaction, also used by the simulator
+// ============================================================================================================================
+func (t *SimpleChaincode) invokeTx(stub stateStub, function string, args []string) ([]byte, error) {
+	cache := newTxCache(stub)												//reads hit the peer once, writes go out once per key
+	res, err := t.invoke(cache, function, args)
+	if err != nil {
+		return nil, err
+	}
+	err = cache.flush()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ============================================================================================================================
+// invoke - run one invocation against the stub, or against a batch's cache
+// ============================================================================================================================
+func (t *SimpleChaincode) invoke(stub stateStub, function string, args []string) ([]byte, error) {
 	fmt.Println("invoke is running " + function)
 
 	// Handle different functions
 	if function == "init" {													//initialize the chaincode state, used as reset
-		return t.Init(stub, "init", args)
-	} else if function == "delete" {										//deletes an entity from its state
+		err := requireAdminCaller(stub)
+		if err != nil {
+			return nil, err
+		}
+		return t.reset(stub, args)
+	} else if function == "register_user" {								//bind a user name to the caller's certificate
+		return t.register_user(stub, args)
+	} else if function == "batch" {											//run many invocations as one
+		return t.batch(stub, args)
+	} else if function == "delete" {										//admin repair tool, deletes an entity from its state
 		res, err := t.Delete(stub, args)
 		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanSales(stub)													//drop listings the seller no longer owns
+		return res, err
+	} else if function == "burn_marble" {									//owner takes a marble out of circulation
+		res, err := t.burn_marble(stub, args)
+		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanSales(stub)													//drop listings the seller no longer owns
+		return res, err
+	} else if function == "split_marble" {									//break a marble into smaller ones of the same color
+		res, err := t.split_marble(stub, args)
+		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanSales(stub)													//drop listings the seller no longer owns
+		return res, err
+	} else if function == "merge_marbles" {									//fuse marbles of the same color into one
+		res, err := t.merge_marbles(stub, args)
+		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanSales(stub)													//drop listings the seller no longer owns
+		return res, err
+	} else if function == "set_attribute_schema" {							//declare the attributes a collection's marbles carry
+		return t.set_attribute_schema(stub, args)
+	} else if function == "register_asset_type" {							//declare a new kind of asset
+		return t.register_asset_type(stub, args)
+	} else if function == "create_asset" {									//admins create an asset of a registered type
+		return t.create_asset(stub, args)
+	} else if function == "transfer_asset" {								//hand an asset to someone else
+		res, err := t.transfer_asset(stub, args)
+		cleanAssetTrades(stub)												//lets make sure all open asset trades are still valid
+		return res, err
+	} else if function == "open_asset_trade" {								//offer assets for an asset
+		return t.open_asset_trade(stub, args)
+	} else if function == "perform_asset_trade" {							//forfill an open asset trade
+		res, err := t.perform_asset_trade(stub, args)
+		cleanAssetTrades(stub)												//lets clean just in case
+		return res, err
+	} else if function == "remove_asset_trade" {							//cancel an open asset trade
+		return t.remove_asset_trade(stub, args)
+	} else if function == "import_state" {									//load a snapshot made by export_state
+		return t.import_state(stub, args)
+	} else if function == "import_marbles_csv" {							//create marbles from csv rows, reporting bad rows
+		return t.import_marbles_csv(stub, args, false)
+	} else if function == "write" {											//admins write a value to the chaincode state
+		res, err := t.Write(stub, args)
+		cleanTrades(stub)													//lets make sure all open trades are still valid
 		return res, err
-	} else if function == "write" {											//writes a value to the chaincode state
-		return t.Write(stub, args)
 	} else if function == "init_marble" {									//create a new marble
 		return t.init_marble(stub, args)
 	} else if function == "set_user" {										//change owner of a marble
 		res, err := t.set_user(stub, args)
 		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanSales(stub)													//drop listings the seller no longer owns
 		return res, err
 	} else if function == "open_trade" {									//create a new trade order
 		return t.open_trade(stub, args)
 	} else if function == "perform_trade" {									//forfill an open trade order
 		res, err := t.perform_trade(stub, args)
 		cleanTrades(stub)													//lets clean just in case
+		cleanSales(stub)													//drop listings the seller no longer owns
 		return res, err
 	} else if function == "remove_trade" {									//cancel an open trade order
 		return t.remove_trade(stub, args)
+	} else if function == "amend_trade" {									//edit an open trade order in place
+		return t.amend_trade(stub, args)
+	} else if function == "set_fee_policy" {								//change the fees charged when marbles change hands
+		return t.set_fee_policy(stub, args)
+	} else if function == "fund_account" {									//move tokens from the "abc" reserve to a user
+		return t.fund_account(stub, args)
+	} else if function == "mint" {											//create new tokens for a user
+		return t.mint(stub, args)
+	} else if function == "transfer" {										//send tokens to another user
+		return t.transfer(stub, args)
+	} else if function == "list_for_sale" {									//offer a marble for tokens
+		return t.list_for_sale(stub, args)
+	} else if function == "unlist_marble" {									//take a marble off the market
+		return t.unlist_marble(stub, args)
+	} else if function == "buy_marble" {									//pay for a listed marble
+		res, err := t.buy_marble(stub, args)
+		cleanTrades(stub)													//lets make sure all open trades are still valid
+		return res, err
+	} else if function == "start_auction" {									//escrow a marble and open it for bids
+		res, err := t.start_auction(stub, args)
+		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanSales(stub)													//drop listings the seller no longer owns
+		return res, err
+	} else if function == "place_bid" {										//bid tokens on an auction
+		return t.place_bid(stub, args)
+	} else if function == "reveal_bid" {									//open a sealed bid
+		return t.reveal_bid(stub, args)
+	} else if function == "close_auction" {									//pay the seller and hand over the marble
+		res, err := t.close_auction(stub, args)
+		cleanTrades(stub)													//lets make sure all open trades are still valid
+		return res, err
+	} else if function == "define_collection" {								//cap the supply and sizes of a color
+		return t.define_collection(stub, args)
+	} else if function == "authorize_minter" {								//let a user mint a collection
+		return t.authorize_minter(stub, args)
+	} else if function == "revoke_minter" {									//stop a user minting a collection
+		return t.revoke_minter(stub, args)
+	} else if function == "settle_cycle" {									//forfill a ring of open trade orders at once
+		res, err := t.settle_cycle(stub, args)
+		cleanTrades(stub)													//lets clean just in case
+		cleanSales(stub)													//drop listings the seller no longer owns
+		return res, err
 	}
 	fmt.Println("invoke did not find func: " + function)					//error
 
@@ -157,11 +369,48 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 // Query - Our entry point for Queries
 // ============================================================================================================================
 func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	res, err := t.query(newTxCache(stub), function, args)						//queries never flush, the cache only saves reads
+	txlog.Record(stub, "query", function, args, res, err)
+	return res, err
+}
+
+// ============================================================================================================================
+// query - run one query against the stub
+// ============================================================================================================================
+func (t *SimpleChaincode) query(stub stateStub, function string, args []string) ([]byte, error) {
 	fmt.Println("query is running " + function)
 
 	// Handle different functions
 	if function == "read" {													//read a variable
 		return t.read(stub, args)
+	} else if function == "balance_of" {									//read a user's token balance
+		return t.balance_of(stub, args)
+	} else if function == "total_supply" {									//read how many tokens exist
+		return t.total_supply(stub, args)
+	} else if function == "marbles_for_sale" {								//list marbles that can be bought for tokens
+		return t.marbles_for_sale(stub, args)
+	} else if function == "read_auction" {									//read an auction and its bids
+		return t.read_auction(stub, args)
+	} else if function == "export_state" {									//page through a snapshot of the chaincode state
+		return t.export_state(stub, args)
+	} else if function == "import_marbles_csv" {							//dry run, report what a csv import would create
+		return t.import_marbles_csv(stub, args, true)
+	} else if function == "read_asset" {									//read an asset of a registered type
+		return t.read_asset(stub, args)
+	} else if function == "list_assets" {									//assets of a type, optionally by field value
+		return t.list_assets(stub, args)
+	} else if function == "open_asset_trades" {								//every open asset trade
+		return t.open_asset_trades(stub, args)
+	} else if function == "marbles_by_attribute" {							//live marbles with an attribute value
+		return t.marbles_by_attribute(stub, args)
+	} else if function == "marble_history" {								//every change of a marble's owner or status
+		return t.marble_history(stub, args)
+	} else if function == "burned_marbles" {								//tombstones of burned marbles, for auditors
+		return t.burned_marbles(stub, args)
+	} else if function == "collection_stats" {								//minted, burned and circulating counts for a color
+		return t.collection_stats(stub, args)
+	} else if function == "find_cycles" {									//suggest rings of open trades that could be settled
+		return t.find_cycles(stub, args)
 	}
 	fmt.Println("query did not find func: " + function)						//error
 
@@ -171,7 +420,7 @@ func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args
 // ============================================================================================================================
 // Read - read a variable from chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) read(stub stateStub, args []string) ([]byte, error) {
 	var name, jsonResp string
 	var err error
 
@@ -190,58 +439,77 @@ func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte,
 }
 
 // ============================================================================================================================
-// Delete - remove a key/value pair from state
+// Delete - admin repair tool, remove a key/value pair from state. Owners should use burn_marble instead
 // ============================================================================================================================
-func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
-	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+func (t *SimpleChaincode) Delete(stub stateStub, args []string) ([]byte, error) {
+	//   0        1
+	// "admin", "name"
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+	
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	
+	name := args[1]
+	marbleAsBytes, err := stub.GetState(name)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	res := Marble{}
+	json.Unmarshal(marbleAsBytes, &res)										//un stringify it aka JSON.parse()
+	if res.Name == name && res.Status != burnedStatus {						//a live marble, take it out of its collection's supply
+		touchMarble(stub, res)
+		err = recordBurn(stub, res.Color)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		touchAll(stub)															//repairing some other key, recheck every trade
 	}
 	
-	name := args[0]
-	err := stub.DelState(name)													//remove the key from chaincode state
+	err = stub.DelState(name)													//remove the key from chaincode state
 	if err != nil {
 		return nil, errors.New("Failed to delete state")
 	}
 
-	//get the marble index
-	marblesAsBytes, err := stub.GetState(marbleIndexStr)
+	err = removeFromIndex(stub, marbleIndexStr, name)							//remove marble from index
 	if err != nil {
-		return nil, errors.New("Failed to get marble index")
+		return nil, err
 	}
-	var marbleIndex []string
-	json.Unmarshal(marblesAsBytes, &marbleIndex)								//un stringify it aka JSON.parse()
-	
-	//remove marble from index
-	for i,val := range marbleIndex{
-		fmt.Println(strconv.Itoa(i) + " - looking at " + val + " for " + name)
-		if val == name{															//find the correct marble
-			fmt.Println("found marble")
-			marbleIndex = append(marbleIndex[:i], marbleIndex[i+1:]...)			//remove it
-			for x:= range marbleIndex{											//debug prints...
-				fmt.Println(string(x) + " - " + marbleIndex[x])
-			}
-			break
-		}
+	err = removeFromIndex(stub, burnedIndexStr, name)
+	if err != nil {
+		return nil, err
 	}
-	jsonAsBytes, _ := json.Marshal(marbleIndex)									//save new index
-	err = stub.PutState(marbleIndexStr, jsonAsBytes)
 	return nil, nil
 }
 
 // ============================================================================================================================
-// Write - write variable into chaincode state
+// Write - admins write a variable into chaincode state, reserved keys only change through their own invokes
 // ============================================================================================================================
-func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) Write(stub stateStub, args []string) ([]byte, error) {
 	var name, value string // Entities
 	var err error
 	fmt.Println("running write()")
 
-	if len(args) != 2 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
+	//	0		1		2
+	//["admin", "name", "value"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3. admin, name of the variable and value to set")
+	}
+	err = requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
 	}
 
-	name = args[0]															//rename for funsies
-	value = args[1]
+	name = args[1]															//rename for funsies
+	value = args[2]
+	if isSystemAccount(name) {												//balances, indexes and bindings only change through their invokes
+		return nil, errors.New("Cannot write to " + name + ", it is reserved")
+	}
+	touchAll(stub)															//could be anything, even a marble
 	err = stub.PutState(name, []byte(value))								//write the variable into the chaincode state
 	if err != nil {
 		return nil, err
@@ -252,19 +520,22 @@ func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte
 // ============================================================================================================================
 // Init Marble - create a new marble, store into chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) init_marble(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) init_marble(stub stateStub, args []string) ([]byte, error) {
 	var err error
 
-	//   0       1       2     3
-	// "asdf", "blue", "35", "bob"
-	if len(args) != 4 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	//   0       1       2     3       4              5
+	// "asdf", "blue", "35", "bob", *"minter"*, *"rarity=rare;pattern=swirl"*   - colors with a collection need an authorized minter
+	if len(args) < 4 || len(args) > 6 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4 to 6")
 	}
 
 	fmt.Println("- start init marble")
 	if len(args[0]) <= 0 {
 		return nil, errors.New("1st argument must be a non-empty string")
 	}
+	if isSystemAccount(args[0]) {											//the name is the state key, keep it off the reserve and "_" keys
+		return nil, errors.New("Marble names cannot start with _ or be " + reserveStr)
+	}
 	if len(args[1]) <= 0 {
 		return nil, errors.New("2nd argument must be a non-empty string")
 	}
@@ -282,9 +553,44 @@ func (t *SimpleChaincode) init_marble(stub *shim.ChaincodeStub, args []string) (
 	
 	color := strings.ToLower(args[1])
 	user := strings.ToLower(args[3])
+	minter := user
+	if len(args) >= 5 && len(args[4]) > 0 {
+		minter = strings.ToLower(args[4])
+	}
+	err = checkCaller(stub, minter)											//the minter earns royalties, only they may claim it
+	if err != nil {
+		return nil, err
+	}
+	var attrs map[string]string
+	if len(args) == 6 {
+		attrs, err = parseAttributes(args[5])
+		if err != nil {
+			return nil, err
+		}
+	}
+	
+	//check if marble already exists
+	marbleAsBytes, err := stub.GetState(args[0])
+	if err != nil {
+		return nil, errors.New("Failed to get marble name")
+	}
+	res := Marble{}
+	json.Unmarshal(marbleAsBytes, &res)
+	if res.Name == args[0] {
+		return nil, errors.New("This marble already exists")
+	}
+	
+	err = checkAttributes(stub, color, attrs)								//collection attribute schema
+	if err != nil {
+		return nil, err
+	}
+	err = checkMint(stub, color, size, minter)								//collection caps, sizes and minters
+	if err != nil {
+		return nil, err
+	}
 
-	str := `{"name": "` + args[0] + `", "color": "` + color + `", "size": ` + strconv.Itoa(size) + `, "user": "` + user + `"}`
-	err = stub.PutState(args[0], []byte(str))								//store marble with id as key
+	marble := Marble{Name: args[0], Color: color, Size: size, User: user, Minter: minter, Attributes: attrs}
+	err = putMarble(stub, marble, "minted", "")								//store marble with id as key
 	if err != nil {
 		return nil, err
 	}
@@ -308,9 +614,9 @@ func (t *SimpleChaincode) init_marble(stub *shim.ChaincodeStub, args []string) (
 }
 
 // ============================================================================================================================
-// Set User Permission on Marble
+// Set User Permission on Marble - the owner or an admin hands a marble to someone else, the owner pays any fees
 // ============================================================================================================================
-func (t *SimpleChaincode) set_user(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) set_user(stub stateStub, args []string) ([]byte, error) {
 	var err error
 	
 	//   0       1
@@ -321,16 +627,33 @@ func (t *SimpleChaincode) set_user(stub *shim.ChaincodeStub, args []string) ([]b
 	
 	fmt.Println("- start set user")
 	fmt.Println(args[0] + " - " + args[1])
+	if len(args[1]) <= 0 || isSystemAccount(args[1]) {
+		return nil, errors.New("2nd argument must be a user")
+	}
 	marbleAsBytes, err := stub.GetState(args[0])
 	if err != nil {
 		return nil, errors.New("Failed to get thing")
 	}
 	res := Marble{}
 	json.Unmarshal(marbleAsBytes, &res)										//un stringify it aka JSON.parse()
-	res.User = args[1]														//change the user
-	
-	jsonAsBytes, _ := json.Marshal(res)
-	err = stub.PutState(args[0], jsonAsBytes)								//rewrite the marble with id as key
+	if res.Name != args[0] {
+		return nil, errors.New("Did not find marble " + args[0])
+	}
+	if res.Status == burnedStatus {
+		return nil, errors.New("Marble " + args[0] + " is burned")
+	}
+	if isSystemAccount(res.User) {											//escrowed marbles only move through their auction
+		return nil, errors.New(res.User + " is a system account")
+	}
+	err = checkOwner(stub, res.User)										//only the owner or an admin hands a marble over
+	if err != nil {
+		return nil, err
+	}
+	_, err = giftFees(stub, res, args[1])									//the owner giving it away pays, the new owner never agreed to
+	if err != nil {
+		return nil, err
+	}
+	err = setOwner(stub, res, args[1])
 	if err != nil {
 		return nil, err
 	}
@@ -339,16 +662,45 @@ func (t *SimpleChaincode) set_user(stub *shim.ChaincodeStub, args []string) ([]b
 	return nil, nil
 }
 
+// ============================================================================================================================
+// transferMarble - change the owner of a marble, charging the fee policy to the new owner
+// ============================================================================================================================
+func transferMarble(stub stateStub, name string, user string) ([]FeeCharge, error) {
+	marbleAsBytes, err := stub.GetState(name)
+	if err != nil {
+		return nil, errors.New("Failed to get thing")
+	}
+	res := Marble{}
+	json.Unmarshal(marbleAsBytes, &res)										//un stringify it aka JSON.parse()
+	if res.Status == burnedStatus {
+		return nil, errors.New("Marble " + name + " is burned")
+	}
+	
+	fees, err := chargeFees(stub, res, user)
+	if err != nil {
+		return nil, err
+	}
+	touchMarble(stub, res)													//open trades offering it need a look
+	from := res.User
+	res.User = user															//change the user
+	
+	err = putMarble(stub, res, "transferred", from)							//rewrite the marble with id as key
+	if err != nil {
+		return nil, err
+	}
+	return fees, nil
+}
+
 // ============================================================================================================================
 // Open Trade - create an open trade for a marble you want with marbles you have 
 // ============================================================================================================================
-func (t *SimpleChaincode) open_trade(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) open_trade(stub stateStub, args []string) ([]byte, error) {
 	var err error
-	var will_size int
 	var trade_away Description
 	
 	//	0        1      2     3      4      5       6
 	//["bob", "blue", "16", "red", "16"] *"blue", "35*
+	//a color may carry attribute constraints like "blue;rarity=rare"
 	if len(args) < 5 {
 		return nil, errors.New("Incorrect number of arguments. Expecting like 5?")
 	}
@@ -356,31 +708,33 @@ func (t *SimpleChaincode) open_trade(stub *shim.ChaincodeStub, args []string) ([
 		return nil, errors.New("Incorrect number of arguments. Expecting an odd number")
 	}
 
-	size1, err := strconv.Atoi(args[2])
+	err = checkActor(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	want, err := parseDescription(args[1], args[2])
 	if err != nil {
 		return nil, errors.New("3rd argument must be a numeric string")
 	}
 
 	open := AnOpenTrade{}
 	open.User = args[0]
-	open.Timestamp = makeTimestamp()											//use timestamp as an ID
-	open.Want.Color = args[1]
-	open.Want.Size =  size1
+	open.Timestamp, err = makeTimestamp(stub)										//use timestamp as an ID
+	if err != nil {
+		return nil, err
+	}
+	open.Want = want
 	fmt.Println("- start open trade")
 	jsonAsBytes, _ := json.Marshal(open)
 	err = stub.PutState("_debug1", jsonAsBytes)
 
 	for i:=3; i < len(args); i++ {												//create and append each willing trade
-		will_size, err = strconv.Atoi(args[i + 1])
+		trade_away, err = parseDescription(args[i], args[i + 1])
 		if err != nil {
-			msg := "is not a numeric string " + args[i + 1]
+			msg := err.Error()
 			fmt.Println(msg)
 			return nil, errors.New(msg)
 		}
-		
-		trade_away = Description{}
-		trade_away.Color = args[i]
-		trade_away.Size =  will_size
 		fmt.Println("! created trade_away: " + args[i])
 		jsonAsBytes, _ = json.Marshal(trade_away)
 		err = stub.PutState("_debug2", jsonAsBytes)
@@ -400,8 +754,7 @@ func (t *SimpleChaincode) open_trade(stub *shim.ChaincodeStub, args []string) ([
 	
 	trades.OpenTrades = append(trades.OpenTrades, open);						//append to open trades
 	fmt.Println("! appended open to trades")
-	jsonAsBytes, _ = json.Marshal(trades)
-	err = stub.PutState(openTradesStr, jsonAsBytes)								//rewrite open orders
+	err = putOpenTrades(stub, trades)								//rewrite open orders
 	if err != nil {
 		return nil, err
 	}
@@ -412,7 +765,7 @@ func (t *SimpleChaincode) open_trade(stub *shim.ChaincodeStub, args []string) ([
 // ============================================================================================================================
 // Perform Trade - close an open trade and move ownership
 // ============================================================================================================================
-func (t *SimpleChaincode) perform_trade(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) perform_trade(stub stateStub, args []string) ([]byte, error) {
 	var err error
 	
 	//	0		1					2					3				4					5
@@ -426,8 +779,12 @@ func (t *SimpleChaincode) perform_trade(stub *shim.ChaincodeStub, args []string)
 	if err != nil {
 		return nil, errors.New("1st argument must be a numeric string")
 	}
+	err = checkActor(stub, args[1])												//the closer pays fees on what they receive
+	if err != nil {
+		return nil, err
+	}
 	
-	size, err := strconv.Atoi(args[5])
+	option, err := parseDescription(args[4], args[5])
 	if err != nil {
 		return nil, errors.New("6th argument must be a numeric string")
 	}
@@ -453,26 +810,41 @@ func (t *SimpleChaincode) perform_trade(stub *shim.ChaincodeStub, args []string)
 			closersMarble := Marble{}
 			json.Unmarshal(marbleAsBytes, &closersMarble)											//un stringify it aka JSON.parse()
 			
+			if closersMarble.Name != args[2] || strings.ToLower(closersMarble.User) != strings.ToLower(args[1]) {
+				return nil, errors.New(args[1] + " does not own " + args[2])
+			}
+			
 			//verify if marble meets trade requirements
-			if closersMarble.Color != trades.OpenTrades[i].Want.Color || closersMarble.Size != trades.OpenTrades[i].Want.Size {
+			if !matchesDescription(closersMarble, trades.OpenTrades[i].Want) {
 				msg := "marble in input does not meet trade requriements"
 				fmt.Println(msg)
 				return nil, errors.New(msg)
 			}
 			
-			marble, e := findMarble4Trade(stub, trades.OpenTrades[i].User, args[4], size)			//find a marble that is suitable from opener
+			marble, e := findMarble4Trade(stub, trades.OpenTrades[i].User, option)				//find a marble that is suitable from opener
 			if(e == nil){
 				fmt.Println("! no errors, proceeding")
 
-				t.set_user(stub, []string{args[2], trades.OpenTrades[i].User})						//change owner of selected marble, closer -> opener
-				t.set_user(stub, []string{marble.Name, args[1]})									//change owner of selected marble, opener -> closer
+				openerFees, err := transferMarble(stub, args[2], trades.OpenTrades[i].User)		//change owner of selected marble, closer -> opener
+				if err != nil {
+					return nil, err
+				}
+				closerFees, err := transferMarble(stub, marble.Name, args[1])						//change owner of selected marble, opener -> closer
+				if err != nil {
+					return nil, err
+				}
 			
 				trades.OpenTrades = append(trades.OpenTrades[:i], trades.OpenTrades[i+1:]...)		//remove trade
-				jsonAsBytes, _ := json.Marshal(trades)
-				err = stub.PutState(openTradesStr, jsonAsBytes)										//rewrite open orders
+				err = putOpenTrades(stub, trades)										//rewrite open orders
+				if err != nil {
+					return nil, err
+				}
+				
+				err = sendTradeFilled(stub, []int64{timestamp}, append(openerFees, closerFees...))
 				if err != nil {
 					return nil, err
 				}
+				break
 			}
 		}
 	}
@@ -483,53 +855,48 @@ func (t *SimpleChaincode) perform_trade(stub *shim.ChaincodeStub, args []string)
 // ============================================================================================================================
 // findMarble4Trade - look for a matching marble that this user owns and return it
 // ============================================================================================================================
-func findMarble4Trade(stub *shim.ChaincodeStub, user string, color string, size int )(m Marble, err error){
-	var fail Marble;
+func findMarble4Trade(stub stateStub, user string, desc Description)(m Marble, err error){
+	var found Marble
 	fmt.Println("- start find marble 4 trade")
-	fmt.Println("looking for " + user + ", " + color + ", " + strconv.Itoa(size));
-
-	//get the marble index
-	marblesAsBytes, err := stub.GetState(marbleIndexStr)
-	if err != nil {
-		return fail, errors.New("Failed to get marble index")
-	}
-	var marbleIndex []string
-	json.Unmarshal(marblesAsBytes, &marbleIndex)								//un stringify it aka JSON.parse()
-	
-	for i:= range marbleIndex{													//iter through all the marbles
-		//fmt.Println("looking @ marble name: " + marbleIndex[i]);
+	fmt.Println("looking for " + user + ", " + desc.Color + ", " + strconv.Itoa(desc.Size));
 
-		marbleAsBytes, err := stub.GetState(marbleIndex[i])						//grab this marble
+	ok, err := findInIndex(stub, marbleIndexStr, func(name string) (bool, error) {
+		marbleAsBytes, err := stub.GetState(name)								//grab this marble
 		if err != nil {
-			return fail, errors.New("Failed to get marble")
+			return false, errors.New("Failed to get marble")
 		}
 		res := Marble{}
 		json.Unmarshal(marbleAsBytes, &res)										//un stringify it aka JSON.parse()
-		//fmt.Println("looking @ " + res.User + ", " + res.Color + ", " + strconv.Itoa(res.Size));
-		
-		//check for user && color && size
-		if strings.ToLower(res.User) == strings.ToLower(user) && strings.ToLower(res.Color) == strings.ToLower(color) && res.Size == size{
-			fmt.Println("found a marble: " + res.Name)
-			fmt.Println("! end find marble 4 trade")
-			return res, nil
-		}
+		found = res
+		return strings.ToLower(res.User) == strings.ToLower(user) && matchesDescription(res, desc), nil	//check for user && color && size && attributes
+	})
+	if err != nil {
+		return Marble{}, err
 	}
-	
-	fmt.Println("- end find marble 4 trade - error")
-	return fail, errors.New("Did not find marble to use in this trade")
+	if !ok {
+		fmt.Println("- end find marble 4 trade - error")
+		return Marble{}, errors.New("Did not find marble to use in this trade")
+	}
+	fmt.Println("found a marble: " + found.Name)
+	fmt.Println("! end find marble 4 trade")
+	return found, nil
 }
 
 // ============================================================================================================================
-// Make Timestamp - create a timestamp in ms
+// Make Timestamp - create a timestamp in ms from the transaction time, never the local clock since peers would disagree
 // ============================================================================================================================
-func makeTimestamp() int64 {
-    return time.Now().UnixNano() / (int64(time.Millisecond)/int64(time.Nanosecond))
+func makeTimestamp(stub stateStub) (int64, error) {
+	ts, err := stub.GetTxTimestamp()											//the transaction's time is the same on every peer and on replay
+	if err != nil || ts == nil {
+		return 0, errors.New("Failed to get transaction timestamp")
+	}
+	return ts.Seconds * 1000 + int64(ts.Nanos) / int64(time.Millisecond), nil
 }
 
 // ============================================================================================================================
 // Remove Open Trade - close an open trade
 // ============================================================================================================================
-func (t *SimpleChaincode) remove_trade(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) remove_trade(stub stateStub, args []string) ([]byte, error) {
 	var err error
 	
 	//	0
@@ -557,8 +924,7 @@ func (t *SimpleChaincode) remove_trade(stub *shim.ChaincodeStub, args []string)
 		if trades.OpenTrades[i].Timestamp == timestamp{
 			fmt.Println("found the trade");
 			trades.OpenTrades = append(trades.OpenTrades[:i], trades.OpenTrades[i+1:]...)				//remove this trade
-			jsonAsBytes, _ := json.Marshal(trades)
-			err = stub.PutState(openTradesStr, jsonAsBytes)												//rewrite open orders
+			err = putOpenTrades(stub, trades)												//rewrite open orders
 			if err != nil {
 				return nil, err
 			}
@@ -572,11 +938,25 @@ func (t *SimpleChaincode) remove_trade(stub *shim.ChaincodeStub, args []string)
 
 // ============================================================================================================================
 // Clean Up Open Trades - make sure open trades are still possible, remove choices that are no longer possible, remove trades that have no valid choices
+//                       only options in an owner/color/size bucket a marble left during this transaction are checked again
 // ============================================================================================================================
-func cleanTrades(stub *shim.ChaincodeStub)(err error){
-	var didWork = false
+func cleanTrades(stub stateStub)(err error){
 	fmt.Println("- start clean trades")
 	
+	buckets, all := takeTouched(stub)
+	var check map[int64]bool
+	if !all {
+		check, err = tradesInBuckets(stub, buckets)
+		if err != nil {
+			return err
+		}
+		if len(check) == 0 {
+			fmt.Println("! no open trades offer a marble that changed hands")
+			fmt.Println("- end clean trades")
+			return nil
+		}
+	}
+	
 	//get the open trade struct
 	tradesAsBytes, err := stub.GetState(openTradesStr)
 	if err != nil {
@@ -586,47 +966,11 @@ func cleanTrades(stub *shim.ChaincodeStub)(err error){
 	json.Unmarshal(tradesAsBytes, &trades)																		//un stringify it aka JSON.parse()
 	
 	fmt.Println("# trades " + strconv.Itoa(len(trades.OpenTrades)))
-	for i:=0; i<len(trades.OpenTrades); {																		//iter over all the known open trades
-		fmt.Println(strconv.Itoa(i) + ": looking at trade " + strconv.FormatInt(trades.OpenTrades[i].Timestamp, 10))
-		
-		fmt.Println("# options " + strconv.Itoa(len(trades.OpenTrades[i].Willing)))
-		for x:=0; x<len(trades.OpenTrades[i].Willing); {														//find a marble that is suitable
-			fmt.Println("! on next option " + strconv.Itoa(i) + ":" + strconv.Itoa(x))
-			_, e := findMarble4Trade(stub, trades.OpenTrades[i].User, trades.OpenTrades[i].Willing[x].Color, trades.OpenTrades[i].Willing[x].Size)
-			if(e != nil){
-				fmt.Println("! errors with this option, removing option")
-				didWork = true
-				trades.OpenTrades[i].Willing = append(trades.OpenTrades[i].Willing[:x], trades.OpenTrades[i].Willing[x+1:]...)	//remove this option
-				x--;
-			}else{
-				fmt.Println("! this option is fine")
-			}
-			
-			x++
-			fmt.Println("! x:" + strconv.Itoa(x))
-			if x >= len(trades.OpenTrades[i].Willing) {														//things might have shifted, recalcuate
-				break
-			}
-		}
-		
-		if len(trades.OpenTrades[i].Willing) == 0 {
-			fmt.Println("! no more options for this trade, removing trade")
-			didWork = true
-			trades.OpenTrades = append(trades.OpenTrades[:i], trades.OpenTrades[i+1:]...)					//remove this trade
-			i--;
-		}
-		
-		i++
-		fmt.Println("! i:" + strconv.Itoa(i))
-		if i >= len(trades.OpenTrades) {																	//things might have shifted, recalcuate
-			break
-		}
-	}
+	didWork := dropUncovered(&marbleTrades{stub: stub, trades: &trades, all: all, check: check, buckets: buckets})
 
-	if(didWork){
+	if(didWork || all){														//a full pass also rebuilds the bucket index
 		fmt.Println("! saving open trade changes")
-		jsonAsBytes, _ := json.Marshal(trades)
-		err = stub.PutState(openTradesStr, jsonAsBytes)														//rewrite open orders
+		err = putOpenTrades(stub, trades)														//rewrite open orders
 		if err != nil {
 			return err
 		}
@@ -636,4 +980,307 @@ func cleanTrades(stub *shim.ChaincodeStub)(err error){
 
 	fmt.Println("- end clean trades")
 	return nil
-}
\ No newline at end of file
+}
+
+// ============================================================================================================================
+// Settle Cycle - close a ring of open trades where each opener's want is covered by the next opener's willing marbles
+// ============================================================================================================================
+func (t *SimpleChaincode) settle_cycle(stub stateStub, args []string) ([]byte, error) {
+	var err error
+	
+	//	0		1		2		...
+	//[trade id, trade id, trade id, ...]   - trade n gets its want from trade n+1, the last trade gets its want from the first
+	if len(args) < 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting at least 2 trade ids")
+	}
+	
+	fmt.Println("- start settle cycle")
+	
+	//get the open trade struct
+	tradesAsBytes, err := stub.GetState(openTradesStr)
+	if err != nil {
+		return nil, errors.New("Failed to get opentrades")
+	}
+	var trades AllTrades
+	json.Unmarshal(tradesAsBytes, &trades)															//un stringify it aka JSON.parse()
+	
+	//find each trade in the ring
+	var ring []AnOpenTrade
+	users := map[string]bool{}
+	for _, id := range args {
+		timestamp, err := strconv.ParseInt(id, 10, 64)
+		if err != nil {
+			return nil, errors.New("trade id must be a numeric string " + id)
+		}
+		pos := findOpenTrade(trades, timestamp)
+		if pos < 0 {
+			return nil, errors.New("Did not find open trade " + id)
+		}
+		user := strings.ToLower(trades.OpenTrades[pos].User)
+		if users[user] {
+			return nil, errors.New("A user can only appear once in a cycle: " + user)
+		}
+		users[user] = true
+		ring = append(ring, trades.OpenTrades[pos])
+	}
+	
+	//find the marble each opener hands to the previous opener, nothing moves until every step is covered
+	var giving []Marble
+	for i := range ring {
+		next := ring[(i + 1) % len(ring)]
+		marble, e := findMarble4Want(stub, ring[i].Want, next)
+		if e != nil {
+			msg := "trade " + strconv.FormatInt(next.Timestamp, 10) + " cannot cover the want of trade " + strconv.FormatInt(ring[i].Timestamp, 10)
+			fmt.Println(msg)
+			return nil, errors.New(msg)
+		}
+		giving = append(giving, marble)
+	}
+	
+	//move all the marbles
+	var fees []FeeCharge
+	var ids []int64
+	for i := range ring {
+		fmt.Println("! " + giving[i].Name + " -> " + ring[i].User)
+		charged, err := transferMarble(stub, giving[i].Name, ring[i].User)							//change owner, next opener -> this opener
+		if err != nil {
+			return nil, err
+		}
+		fees = append(fees, charged...)
+		ids = append(ids, ring[i].Timestamp)
+	}
+	
+	//remove the settled trades
+	for i := range ring {
+		pos := findOpenTrade(trades, ring[i].Timestamp)
+		trades.OpenTrades = append(trades.OpenTrades[:pos], trades.OpenTrades[pos+1:]...)
+	}
+	err = putOpenTrades(stub, trades)													//rewrite open orders
+	if err != nil {
+		return nil, err
+	}
+	
+	err = sendTradeFilled(stub, ids, fees)
+	if err != nil {
+		return nil, err
+	}
+	
+	fmt.Println("- end settle cycle")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Find Cycles - list rings of open trade ids that settle_cycle could close
+// ============================================================================================================================
+func (t *SimpleChaincode) find_cycles(stub stateStub, args []string) ([]byte, error) {
+	var err error
+	maxLen := 4
+	
+	//	0
+	//[max ring length]  - optional, defaults to 4
+	if len(args) > 0 {
+		maxLen, err = strconv.Atoi(args[0])
+		if err != nil || maxLen < 2 || maxLen > maxCycleLen {
+			return nil, errors.New("1st argument must be a numeric string from 2 to " + strconv.Itoa(maxCycleLen))
+		}
+	}
+	
+	fmt.Println("- start find cycles")
+	
+	//get the open trade struct
+	tradesAsBytes, err := stub.GetState(openTradesStr)
+	if err != nil {
+		return nil, errors.New("Failed to get opentrades")
+	}
+	var trades AllTrades
+	json.Unmarshal(tradesAsBytes, &trades)															//un stringify it aka JSON.parse()
+	n := len(trades.OpenTrades)
+	
+	//edges[i] holds every trade whose opener can cover the want of trade i
+	edges := make([][]int, n)
+	for i := 0; i < n; i++ {
+		for j := 0; j < n; j++ {
+			if i == j || strings.ToLower(trades.OpenTrades[i].User) == strings.ToLower(trades.OpenTrades[j].User) {
+				continue
+			}
+			if _, e := findMarble4Want(stub, trades.OpenTrades[i].Want, trades.OpenTrades[j]); e == nil {
+				edges[i] = append(edges[i], j)
+			}
+		}
+	}
+	
+	//walk rings that start at their lowest index so each ring is only reported once
+	cycles := [][]string{}
+	var walk func(start int, path []int)
+	walk = func(start int, path []int) {
+		last := path[len(path) - 1]
+		for _, next := range edges[last] {
+			if next == start && len(path) >= 2 {
+				var ids []string
+				for _, p := range path {
+					ids = append(ids, strconv.FormatInt(trades.OpenTrades[p].Timestamp, 10))
+				}
+				cycles = append(cycles, ids)
+				continue
+			}
+			if next <= start || len(path) >= maxLen || onPath(trades, path, next) {
+				continue
+			}
+			walk(start, append(path, next))
+		}
+	}
+	for i := 0; i < n; i++ {
+		walk(i, []int{i})
+	}
+	
+	fmt.Println("! found " + strconv.Itoa(len(cycles)) + " cycles")
+	fmt.Println("- end find cycles")
+	return json.Marshal(cycles)
+}
+
+// ============================================================================================================================
+// onPath - true if this trade, or another trade by the same opener, is already part of the ring being walked
+// ============================================================================================================================
+func onPath(trades AllTrades, path []int, next int) bool {
+	for _, p := range path {
+		if p == next || strings.ToLower(trades.OpenTrades[p].User) == strings.ToLower(trades.OpenTrades[next].User) {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// findOpenTrade - position of the open trade with this id, -1 if it is not open
+// ============================================================================================================================
+func findOpenTrade(trades AllTrades, timestamp int64) int {
+	for i := range trades.OpenTrades {
+		if trades.OpenTrades[i].Timestamp == timestamp {
+			return i
+		}
+	}
+	return -1
+}
+
+// ============================================================================================================================
+// findMarble4Want - look for a marble the opener of this trade is willing to give away that covers the want
+// ============================================================================================================================
+func findMarble4Want(stub stateStub, want Description, giver AnOpenTrade) (m Marble, err error) {
+	var fail Marble
+	for _, option := range giver.Willing {
+		if strings.ToLower(option.Color) == strings.ToLower(want.Color) && option.Size == want.Size {
+			both, ok := combineDescriptions(option, want)
+			if !ok {
+				continue
+			}
+			m, err = findMarble4Trade(stub, giver.User, both)
+			if err == nil {
+				return m, nil
+			}																//options can differ only in attributes, try the rest
+		}
+	}
+	return fail, errors.New("Trade is not willing to give away a marble like that")
+}
+
+// ============================================================================================================================
+// Amend Trade - let the opener edit the want or willing options of an open trade without losing its id
+// ============================================================================================================================
+func (t *SimpleChaincode) amend_trade(stub stateStub, args []string) ([]byte, error) {
+	var err error
+	
+	//	0		1		2				3		4
+	//[data.id, "bob", "add_willing", "red", "16"]
+	//[data.id, "bob", "remove_willing", "red", "16"]
+	//[data.id, "bob", "want", "blue", "35"]
+	if len(args) != 5 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 5")
+	}
+	
+	fmt.Println("- start amend trade")
+	timestamp, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return nil, errors.New("1st argument must be a numeric string")
+	}
+	err = checkActor(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	option, err := parseDescription(args[3], args[4])
+	if err != nil {
+		return nil, errors.New("5th argument must be a numeric string")
+	}
+	
+	//get the open trade struct
+	tradesAsBytes, err := stub.GetState(openTradesStr)
+	if err != nil {
+		return nil, errors.New("Failed to get opentrades")
+	}
+	var trades AllTrades
+	json.Unmarshal(tradesAsBytes, &trades)															//un stringify it aka JSON.parse()
+	
+	pos := findOpenTrade(trades, timestamp)
+	if pos < 0 {
+		return nil, errors.New("Did not find open trade " + args[0])
+	}
+	trade := &trades.OpenTrades[pos]
+	if strings.ToLower(trade.User) != strings.ToLower(args[1]) {
+		return nil, errors.New("Only the opener of a trade can amend it")
+	}
+	
+	switch args[2] {
+	case "add_willing":
+		if findWillingOption(*trade, option) >= 0 {
+			return nil, errors.New("Trade is already willing to give away that marble")
+		}
+		if _, e := findMarble4Trade(stub, trade.User, option); e != nil {		//same check clean trades makes
+			return nil, errors.New("Opener does not own a marble like that")
+		}
+		trade.Willing = append(trade.Willing, option)
+	case "remove_willing":
+		x := findWillingOption(*trade, option)
+		if x < 0 {
+			return nil, errors.New("Trade is not willing to give away that marble")
+		}
+		if len(trade.Willing) == 1 {
+			return nil, errors.New("Cannot remove the last option, use remove_trade instead")
+		}
+		removeWillingOption(trade, x)
+	case "want":
+		trade.Want = option
+	default:
+		return nil, errors.New("3rd argument must be add_willing, remove_willing or want")
+	}
+	amendedAt, err := makeTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	trade.Amendments = append(trade.Amendments, Amendment{Timestamp: amendedAt, Action: args[2], Color: option.Color, Size: option.Size, Attributes: option.Attributes})
+	fmt.Println("! amended trade " + args[0] + " - " + args[2])
+	
+	err = putOpenTrades(stub, trades)													//rewrite open orders
+	if err != nil {
+		return nil, err
+	}
+	
+	fmt.Println("- end amend trade")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// findWillingOption - position of this option in the willing list of a trade, -1 if it is not there
+// ============================================================================================================================
+func findWillingOption(trade AnOpenTrade, option Description) int {
+	for x := range trade.Willing {
+		if sameDescription(trade.Willing[x], option) {
+			return x
+		}
+	}
+	return -1
+}
+
+// ============================================================================================================================
+// removeWillingOption - drop option x from the willing list of a trade
+// ============================================================================================================================
+func removeWillingOption(trade *AnOpenTrade, x int) {
+	trade.Willing = append(trade.Willing[:x], trade.Willing[x+1:]...)
+}
@@ -0,0 +1,281 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"strings"
+)
+
+var forSaleStr = "_forsale"					//name for the key/value that will store all marbles listed for tokens
+
+type Listing struct{
+	Marble string `json:"marble"`				//name of the marble for sale
+	Seller string `json:"seller"`				//owner who listed it
+	Price int `json:"price"`					//tokens the buyer pays the seller
+	Timestamp int64 `json:"timestamp"`			//utc timestamp of the listing
+}
+
+type AllSales struct{
+	Listings []Listing `json:"listings"`
+}
+
+type MarbleSold struct{
+	Listing Listing `json:"listing"`
+	Buyer string `json:"buyer"`
+	Fees []FeeCharge `json:"fees"`
+}
+
+// ============================================================================================================================
+// List For Sale - offer a marble you own for a token price, relisting replaces the old price
+// ============================================================================================================================
+func (t *SimpleChaincode) list_for_sale(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0		1		2
+	//["bob", "asdf", "25"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start list for sale")
+	err = checkActor(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	price, err := strconv.Atoi(args[2])
+	if err != nil || price <= 0 {
+		return nil, errors.New("3rd argument must be a positive numeric string")
+	}
+	marbleAsBytes, err := stub.GetState(args[1])
+	if err != nil {
+		return nil, errors.New("Failed to get marble")
+	}
+	marble := Marble{}
+	json.Unmarshal(marbleAsBytes, &marble)										//un stringify it aka JSON.parse()
+	if marble.Name != args[1] || strings.ToLower(marble.User) != strings.ToLower(args[0]) {
+		return nil, errors.New("Only the owner of a marble can list it")
+	}
+
+	sales, err := getSales(stub)
+	if err != nil {
+		return nil, err
+	}
+	if pos := findListing(sales, args[1]); pos >= 0 {
+		sales.Listings = append(sales.Listings[:pos], sales.Listings[pos+1:]...)	//drop the old price
+	}
+	listedAt, err := makeTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	sales.Listings = append(sales.Listings, Listing{Marble: args[1], Seller: strings.ToLower(args[0]), Price: price, Timestamp: listedAt})
+	err = putSales(stub, sales)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end list for sale")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Unlist Marble - the seller takes a marble off the market
+// ============================================================================================================================
+func (t *SimpleChaincode) unlist_marble(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["bob", "asdf"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start unlist marble")
+	err := checkActor(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	sales, err := getSales(stub)
+	if err != nil {
+		return nil, err
+	}
+	pos := findListing(sales, args[1])
+	if pos < 0 {
+		return nil, errors.New("Marble is not for sale")
+	}
+	if sales.Listings[pos].Seller != strings.ToLower(args[0]) {
+		return nil, errors.New("Only the seller can unlist a marble")
+	}
+	sales.Listings = append(sales.Listings[:pos], sales.Listings[pos+1:]...)
+	err = putSales(stub, sales)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end unlist marble")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Buy Marble - pay the seller's price and take ownership, tokens and marble move in the same transaction
+// ============================================================================================================================
+func (t *SimpleChaincode) buy_marble(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["alice", "asdf"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start buy marble")
+	buyer := strings.ToLower(args[0])
+	err := checkActor(stub, buyer)
+	if err != nil {
+		return nil, err
+	}
+	sales, err := getSales(stub)
+	if err != nil {
+		return nil, err
+	}
+	pos := findListing(sales, args[1])
+	if pos < 0 {
+		return nil, errors.New("Marble is not for sale")
+	}
+	listing := sales.Listings[pos]
+	if listing.Seller == buyer {
+		return nil, errors.New("Cannot buy your own marble")
+	}
+
+	marbleAsBytes, err := stub.GetState(listing.Marble)
+	if err != nil {
+		return nil, errors.New("Failed to get marble")
+	}
+	marble := Marble{}
+	json.Unmarshal(marbleAsBytes, &marble)										//un stringify it aka JSON.parse()
+	if strings.ToLower(marble.User) != listing.Seller {
+		return nil, errors.New("Seller no longer owns this marble")
+	}
+
+	err = moveTokens(stub, buyer, listing.Seller, listing.Price)				//pay first, fails if the buyer is short
+	if err != nil {
+		return nil, err
+	}
+	fees, err := transferMarble(stub, listing.Marble, buyer)					//then move the marble, seller -> buyer
+	if err != nil {
+		return nil, err
+	}
+
+	sales.Listings = append(sales.Listings[:pos], sales.Listings[pos+1:]...)
+	err = putSales(stub, sales)
+	if err != nil {
+		return nil, err
+	}
+
+	sold := MarbleSold{Listing: listing, Buyer: buyer, Fees: fees}
+	jsonAsBytes, _ := json.Marshal(sold)
+	err = stub.SetEvent("marble_sold", jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end buy marble")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Marbles For Sale - list every marble that can be bought for tokens
+// ============================================================================================================================
+func (t *SimpleChaincode) marbles_for_sale(stub stateStub, args []string) ([]byte, error) {
+	sales, err := getSales(stub)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sales)
+}
+
+// ============================================================================================================================
+// Clean Up Sales - remove listings for marbles the seller no longer owns
+// ============================================================================================================================
+func cleanSales(stub stateStub)(err error){
+	var didWork = false
+	fmt.Println("- start clean sales")
+
+	sales, err := getSales(stub)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(sales.Listings); i++ {
+		marbleAsBytes, err := stub.GetState(sales.Listings[i].Marble)
+		if err != nil {
+			return errors.New("Failed to get marble")
+		}
+		marble := Marble{}
+		json.Unmarshal(marbleAsBytes, &marble)									//un stringify it aka JSON.parse()
+		if strings.ToLower(marble.User) != sales.Listings[i].Seller {
+			fmt.Println("! seller no longer owns " + sales.Listings[i].Marble + ", removing listing")
+			didWork = true
+			sales.Listings = append(sales.Listings[:i], sales.Listings[i+1:]...)
+			i--
+		}
+	}
+
+	if didWork {
+		err = putSales(stub, sales)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("- end clean sales")
+	return nil
+}
+
+// ============================================================================================================================
+// findListing - position of the listing for this marble, -1 if it is not for sale
+// ============================================================================================================================
+func findListing(sales AllSales, name string) int {
+	for i := range sales.Listings {
+		if sales.Listings[i].Marble == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ============================================================================================================================
+// getSales - read the marbles for sale
+// ============================================================================================================================
+func getSales(stub stateStub) (AllSales, error) {
+	var sales AllSales
+	salesAsBytes, err := stub.GetState(forSaleStr)
+	if err != nil {
+		return sales, errors.New("Failed to get marbles for sale")
+	}
+	json.Unmarshal(salesAsBytes, &sales)										//un stringify it aka JSON.parse()
+	return sales, nil
+}
+
+// ============================================================================================================================
+// putSales - rewrite the marbles for sale
+// ============================================================================================================================
+func putSales(stub stateStub, sales AllSales) error {
+	jsonAsBytes, _ := json.Marshal(sales)
+	return stub.PutState(forSaleStr, jsonAsBytes)
+}
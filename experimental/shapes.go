@@ -0,0 +1,213 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"strings"
+)
+
+// ============================================================================================================================
+// Split Marble - break one marble into smaller marbles of the same color, the sizes must add up to the original
+// ============================================================================================================================
+func (t *SimpleChaincode) split_marble(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2		3		4		5
+	//["name", "bob", "new1", "20", "new2", "15"...]   - pairs of new marble name and size
+	if len(args) < 6 || len(args) % 2 != 0 {
+		return nil, errors.New("Incorrect number of arguments. Expecting name, owner and at least 2 name/size pairs")
+	}
+
+	fmt.Println("- start split marble")
+	user := strings.ToLower(args[1])
+	res, err := getOwnedMarble(stub, args[0], user)
+	if err != nil {
+		return nil, err
+	}
+
+	var pieces []Marble
+	var names []string
+	var sizes []int
+	total := 0
+	for i := 2; i < len(args); i += 2 {
+		size, err := strconv.Atoi(args[i+1])
+		if err != nil || size <= 0 {
+			return nil, errors.New("Size of " + args[i] + " must be a positive numeric string")
+		}
+		err = checkNewName(stub, args[i], names)
+		if err != nil {
+			return nil, err
+		}
+		total += size
+		names = append(names, args[i])
+		sizes = append(sizes, size)
+		pieces = append(pieces, Marble{Name: args[i], Color: res.Color, Size: size, User: user, Minter: res.Minter, Attributes: res.Attributes})
+	}
+	if total != res.Size {
+		return nil, errors.New("Sizes add up to " + strconv.Itoa(total) + ", expecting " + strconv.Itoa(res.Size))
+	}
+
+	err = reshapeCollection(stub, res.Color, sizes, 1)
+	if err != nil {
+		return nil, err
+	}
+	err = tombstone(stub, &res, user)
+	if err != nil {
+		return nil, err
+	}
+	for i := range pieces {
+		err = putNewMarble(stub, pieces[i])
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	fmt.Println("- end split marble")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Merge Marbles - fuse marbles of the same color into one marble as big as all of them together
+// ============================================================================================================================
+func (t *SimpleChaincode) merge_marbles(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2		3
+	//["bob", "new", "name1", "name2"...]
+	if len(args) < 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting owner, new name and at least 2 marbles")
+	}
+
+	fmt.Println("- start merge marbles")
+	user := strings.ToLower(args[0])
+	err := checkNewName(stub, args[1], nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var inputs []Marble
+	total := 0
+	for i := 2; i < len(args); i++ {
+		for x := 2; x < i; x++ {
+			if args[x] == args[i] {
+				return nil, errors.New("Marble " + args[i] + " is listed twice")
+			}
+		}
+		res, err := getOwnedMarble(stub, args[i], user)
+		if err != nil {
+			return nil, err
+		}
+		if len(inputs) > 0 && res.Color != inputs[0].Color {
+			return nil, errors.New("Only marbles of the same color can be merged")
+		}
+		if len(inputs) > 0 && !sameAttributes(res.Attributes, inputs[0].Attributes) {
+			return nil, errors.New("Only marbles with the same attributes can be merged")
+		}
+		total += res.Size
+		inputs = append(inputs, res)
+	}
+
+	err = reshapeCollection(stub, inputs[0].Color, []int{total}, len(inputs))
+	if err != nil {
+		return nil, err
+	}
+	for i := range inputs {
+		err = tombstone(stub, &inputs[i], user)
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = putNewMarble(stub, Marble{Name: args[1], Color: inputs[0].Color, Size: total, User: user, Minter: inputs[0].Minter, Attributes: inputs[0].Attributes})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end merge marbles")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// getOwnedMarble - read a live marble and make sure this user owns it
+// ============================================================================================================================
+func getOwnedMarble(stub stateStub, name string, user string) (Marble, error) {
+	err := checkActor(stub, user)
+	if err != nil {
+		return Marble{}, err
+	}
+	marbleAsBytes, err := stub.GetState(name)
+	if err != nil {
+		return Marble{}, errors.New("Failed to get marble")
+	}
+	res := Marble{}
+	json.Unmarshal(marbleAsBytes, &res)										//un stringify it aka JSON.parse()
+	if res.Name != name || res.Status == burnedStatus {
+		return res, errors.New("Did not find marble " + name)
+	}
+	if strings.ToLower(res.User) != user {
+		return res, errors.New(user + " does not own marble " + name)
+	}
+	return res, nil
+}
+
+// ============================================================================================================================
+// checkNewName - make sure a new marble name is not taken in state or earlier in the same request
+// ============================================================================================================================
+func checkNewName(stub stateStub, name string, earlier []string) error {
+	if len(name) <= 0 {
+		return errors.New("Marble names must be non-empty strings")
+	}
+	if isSystemAccount(name) {
+		return errors.New("Marble names cannot start with _ or be " + reserveStr)
+	}
+	for _, other := range earlier {
+		if other == name {
+			return errors.New("Marble " + name + " is listed twice")
+		}
+	}
+	valAsBytes, err := stub.GetState(name)
+	if err != nil {
+		return errors.New("Failed to get marble name")
+	}
+	if len(valAsBytes) > 0 {
+		return errors.New("The name " + name + " is already taken")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// putNewMarble - store a new marble and add it to the marble index
+// ============================================================================================================================
+func putNewMarble(stub stateStub, res Marble) error {
+	err := putMarble(stub, res, "minted", "")								//store marble with id as key
+	if err != nil {
+		return err
+	}
+
+	marblesAsBytes, err := stub.GetState(marbleIndexStr)
+	if err != nil {
+		return errors.New("Failed to get marble index")
+	}
+	var marbleIndex []string
+	json.Unmarshal(marblesAsBytes, &marbleIndex)								//un stringify it aka JSON.parse()
+	marbleIndex = append(marbleIndex, res.Name)								//add marble name to index list
+	jsonAsBytes, _ := json.Marshal(marbleIndex)
+	return stub.PutState(marbleIndexStr, jsonAsBytes)
+}
@@ -0,0 +1,599 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+)
+
+var snapshotVersion = 2						//bump when the record layout changes
+var snapshotImportStr = "_snapshotimport"	//name for the key/value that will store which page import_state expects next
+
+type SnapshotRecord struct{
+	Kind string `json:"kind"`				//"header", "config", "balance", "marble", "trade", "sale", "auction", "assettype", "asset", "assetlookup" or "assettrade"
+	Version int `json:"version,omitempty"`	//header - layout version of the snapshot
+	Start int `json:"start,omitempty"`		//header - position of the first record on this page
+	Total int `json:"total,omitempty"`		//header - records in the whole snapshot
+	State string `json:"state,omitempty"`	//header - hash of the whole snapshot, the same on every page of one export
+	Key string `json:"key,omitempty"`		//config, balance and assetlookup - state key or user
+	Data string `json:"data,omitempty"`		//config, balance and assetlookup - raw value
+	Value json.RawMessage `json:"value,omitempty"`	//marble, trade, sale, auction and asset records
+}
+
+type SnapshotImport struct{
+	State string `json:"state"`				//hash of the export being imported
+	Next int `json:"next"`					//position the next page must start at
+}
+
+type AuctionSnapshot struct{
+	Auction Auction `json:"auction"`
+	Bids []Bid `json:"bids"`
+}
+
+// ============================================================================================================================
+// Export State - one page of the marbles, assets, trades and config as ndjson, the first line is a header.
+// Each page is cut from the state at the time of its query, the header's state hash tells pages of different states apart
+// ============================================================================================================================
+func (t *SimpleChaincode) export_state(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//[*"0"*, *"100"*]   - first record and page size
+	start, count := 0, 100
+	var err error
+	if len(args) > 0 {
+		start, err = strconv.Atoi(args[0])
+		if err != nil || start < 0 {
+			return nil, errors.New("1st argument must be a non-negative numeric string")
+		}
+	}
+	if len(args) > 1 {
+		count, err = strconv.Atoi(args[1])
+		if err != nil || count <= 0 {
+			return nil, errors.New("2nd argument must be a positive numeric string")
+		}
+	}
+
+	records, err := snapshotRecords(stub)
+	if err != nil {
+		return nil, err
+	}
+	lines := snapshotLines(records)
+	end := start + count
+	if start > len(lines) {
+		start = len(lines)
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+
+	var out bytes.Buffer
+	header, _ := json.Marshal(SnapshotRecord{Kind: "header", Version: snapshotVersion, Start: start, Total: len(lines), State: snapshotHash(lines)})
+	out.Write(header)
+	out.WriteString("\n")
+	for _, line := range lines[start:end] {
+		out.Write(line)
+		out.WriteString("\n")
+	}
+	return out.Bytes(), nil
+}
+
+// ============================================================================================================================
+// Import State - admins load pages made by export_state into a freshly reset ledger, the indexes and open trades are rebuilt
+// as records arrive. Pages go in order from the first, a page from another export or out of order is refused. The ledger keeps
+// its own admins and their certificates, other users keep the certificates they were bound to in the export
+// ============================================================================================================================
+func (t *SimpleChaincode) import_state(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["admin", ndjson]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start import state")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	tradesAsBytes, err := stub.GetState(openTradesStr)
+	if err != nil {
+		return nil, errors.New("Failed to get opentrades")
+	}
+	var trades AllTrades
+	json.Unmarshal(tradesAsBytes, &trades)										//un stringify it aka JSON.parse()
+	sales, err := getSales(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	assetTrades, err := getAssetTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []SnapshotRecord
+	var lineNums []int
+	for i, line := range strings.Split(args[1], "\n") {
+		if len(strings.TrimSpace(line)) == 0 {
+			continue
+		}
+		var record SnapshotRecord
+		err = json.Unmarshal([]byte(line), &record)
+		if err != nil {
+			return nil, errors.New("Line " + strconv.Itoa(i + 1) + ": " + err.Error())
+		}
+		records = append(records, record)
+		lineNums = append(lineNums, i + 1)
+	}
+	if len(records) == 0 || records[0].Kind != "header" {
+		return nil, errors.New("A page must start with its header")
+	}
+	if records[0].Start == 0 {
+		err = checkEmpty(stub)													//records are written over, never merged
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = checkPage(stub, records[0], len(records) - 1)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, record := range records[1:] {
+		if record.Kind == "header" {
+			err = errors.New("A page has only one header")
+		} else {
+			err = importRecord(stub, record, &trades, &sales, &assetTrades)
+		}
+		if err != nil {
+			return nil, errors.New("Line " + strconv.Itoa(lineNums[i + 1]) + ": " + err.Error())
+		}
+	}
+	imported := len(records) - 1
+
+	err = putOpenTrades(stub, trades)
+	if err != nil {
+		return nil, err
+	}
+	err = putSales(stub, sales)
+	if err != nil {
+		return nil, err
+	}
+	err = putAssetTrades(stub, assetTrades)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end import state - " + strconv.Itoa(imported) + " records")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// snapshotRecords - every record of the snapshot in a fixed order, so pages line up between calls
+// ============================================================================================================================
+func snapshotRecords(stub stateStub) ([]SnapshotRecord, error) {
+	var records []SnapshotRecord
+
+	configKeys := []string{adminsStr, identitiesStr, feePolicyStr, reserveStr, totalSupplyStr}
+	collections, err := readIndex(stub, collectionIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, color := range collections {
+		configKeys = append(configKeys, collectionPrefix + color)
+	}
+	for _, key := range configKeys {
+		valAsBytes, err := stub.GetState(key)
+		if err != nil {
+			return nil, errors.New("Failed to get " + key)
+		}
+		records = append(records, SnapshotRecord{Kind: "config", Key: key, Data: string(valAsBytes)})
+	}
+
+	accounts, err := readIndex(stub, accountIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, user := range accounts {
+		bal, err := getBalance(stub, user)
+		if err != nil {
+			return nil, err
+		}
+		records = append(records, SnapshotRecord{Kind: "balance", Key: user, Data: strconv.Itoa(bal)})
+	}
+
+	live, err := readIndex(stub, marbleIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	burned, err := readIndex(stub, burnedIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range append(live, burned...) {
+		marbleAsBytes, err := stub.GetState(name)
+		if err != nil {
+			return nil, errors.New("Failed to get marble")
+		}
+		records = append(records, SnapshotRecord{Kind: "marble", Value: marbleAsBytes})
+	}
+
+	tradesAsBytes, err := stub.GetState(openTradesStr)
+	if err != nil {
+		return nil, errors.New("Failed to get opentrades")
+	}
+	var trades AllTrades
+	json.Unmarshal(tradesAsBytes, &trades)										//un stringify it aka JSON.parse()
+	for _, trade := range trades.OpenTrades {
+		jsonAsBytes, _ := json.Marshal(trade)
+		records = append(records, SnapshotRecord{Kind: "trade", Value: jsonAsBytes})
+	}
+
+	sales, err := getSales(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, listing := range sales.Listings {
+		jsonAsBytes, _ := json.Marshal(listing)
+		records = append(records, SnapshotRecord{Kind: "sale", Value: jsonAsBytes})
+	}
+
+	auctions, err := readIndex(stub, auctionIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range auctions {
+		auction, err := getAuction(stub, id)
+		if err != nil {
+			return nil, err
+		}
+		snap := AuctionSnapshot{Auction: auction}
+		for _, bidder := range auction.Bidders {
+			bid, err := getBid(stub, id, bidder)
+			if err != nil {
+				return nil, err
+			}
+			snap.Bids = append(snap.Bids, bid)
+		}
+		jsonAsBytes, _ := json.Marshal(snap)
+		records = append(records, SnapshotRecord{Kind: "auction", Value: jsonAsBytes})
+	}
+
+	assetRecords, err := snapshotAssetRecords(stub)
+	if err != nil {
+		return nil, err
+	}
+	return append(records, assetRecords...), nil
+}
+
+// ============================================================================================================================
+// snapshotAssetRecords - the asset registry, types before their assets and the lookup lists as they stand
+// ============================================================================================================================
+func snapshotAssetRecords(stub stateStub) ([]SnapshotRecord, error) {
+	var records []SnapshotRecord
+	var lookups []string
+	seen := map[string]bool{}
+
+	typeNames, err := readIndex(stub, assetTypeIndexStr)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range typeNames {
+		assetType, err := getAssetType(stub, name)
+		if err != nil {
+			return nil, err
+		}
+		jsonAsBytes, _ := json.Marshal(assetType)
+		records = append(records, SnapshotRecord{Kind: "assettype", Value: jsonAsBytes})
+
+		ids, err := readIndex(stub, assetIndexPrefix + name)
+		if err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			asset, err := getAsset(stub, name, id)
+			if err != nil {
+				return nil, err
+			}
+			jsonAsBytes, _ := json.Marshal(asset)
+			records = append(records, SnapshotRecord{Kind: "asset", Value: jsonAsBytes})
+			for _, field := range assetType.Indexes {
+				key := assetLookupKey(asset, field)
+				if !seen[key] {
+					seen[key] = true
+					lookups = append(lookups, key)
+				}
+			}
+		}
+	}
+	for _, key := range lookups {												//kept as is, their order is what list_assets returns
+		valAsBytes, err := stub.GetState(key)
+		if err != nil {
+			return nil, errors.New("Failed to get " + key)
+		}
+		records = append(records, SnapshotRecord{Kind: "assetlookup", Key: key, Data: string(valAsBytes)})
+	}
+
+	trades, err := getAssetTrades(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, trade := range trades.OpenTrades {
+		jsonAsBytes, _ := json.Marshal(trade)
+		records = append(records, SnapshotRecord{Kind: "assettrade", Value: jsonAsBytes})
+	}
+	return records, nil
+}
+
+// ============================================================================================================================
+// snapshotLines - the ndjson line of each record
+// ============================================================================================================================
+func snapshotLines(records []SnapshotRecord) [][]byte {
+	var lines [][]byte
+	for _, record := range records {
+		line, _ := json.Marshal(record)
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// ============================================================================================================================
+// snapshotHash - hex sha256 of every line of a snapshot, names the state the pages were cut from
+// ============================================================================================================================
+func snapshotHash(lines [][]byte) string {
+	hash := sha256.New()
+	for _, line := range lines {
+		hash.Write(line)
+		hash.Write([]byte("\n"))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// ============================================================================================================================
+// checkPage - error unless this page is the first of an export or the one after the last page imported
+// ============================================================================================================================
+func checkPage(stub stateStub, header SnapshotRecord, count int) error {
+	if header.Version != snapshotVersion {
+		return errors.New("Snapshot version " + strconv.Itoa(header.Version) + " is not supported, expecting " + strconv.Itoa(snapshotVersion))
+	}
+	if len(header.State) == 0 {
+		return errors.New("The header must carry the state hash of its export")
+	}
+	progress := SnapshotImport{State: header.State}
+	if header.Start > 0 {
+		progressAsBytes, err := stub.GetState(snapshotImportStr)
+		if err != nil {
+			return errors.New("Failed to get " + snapshotImportStr)
+		}
+		json.Unmarshal(progressAsBytes, &progress)								//un stringify it aka JSON.parse()
+		if progress.State != header.State {
+			return errors.New("This page is from a different export than the pages before it, start again from the first page")
+		}
+		if progress.Next != header.Start {
+			return errors.New("Expecting the page starting at " + strconv.Itoa(progress.Next) + ", not " + strconv.Itoa(header.Start))
+		}
+	}
+
+	progress.Next = header.Start + count
+	if progress.Next >= header.Total {											//last page, nothing more to expect
+		return stub.DelState(snapshotImportStr)
+	}
+	jsonAsBytes, _ := json.Marshal(progress)
+	return stub.PutState(snapshotImportStr, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// importRecord - check one snapshot record and write it, trades and sales are gathered for the caller to save
+// ============================================================================================================================
+func importRecord(stub stateStub, record SnapshotRecord, trades *AllTrades, sales *AllSales, assetTrades *AllAssetTrades) error {
+	switch record.Kind {
+	case "config":
+		if record.Key == adminsStr || record.Key == identitiesStr || record.Key == feePolicyStr {
+			var parsed interface{}
+			if err := json.Unmarshal([]byte(record.Data), &parsed); len(record.Data) > 0 && err != nil {
+				return errors.New(record.Key + " must hold json")
+			}
+			if record.Key == adminsStr {
+				return nil															//the admins who run the import stay the admins
+			}
+			if record.Key == identitiesStr {
+				return importIdentities(stub, record.Data)
+			}
+		} else if record.Key == reserveStr || record.Key == totalSupplyStr {
+			if _, err := strconv.Atoi(record.Data); err != nil {
+				return errors.New(record.Key + " must hold a numeric string")
+			}
+		} else if strings.HasPrefix(record.Key, collectionPrefix) {
+			var collection Collection
+			if err := json.Unmarshal([]byte(record.Data), &collection); err != nil || collectionPrefix + collection.Color != record.Key {
+				return errors.New(record.Key + " does not hold its collection")
+			}
+			err := addToIndex(stub, collectionIndexStr, collection.Color)
+			if err != nil {
+				return err
+			}
+		} else {
+			return errors.New("Unknown config key " + record.Key)
+		}
+		return stub.PutState(record.Key, []byte(record.Data))
+	case "balance":
+		bal, err := strconv.Atoi(record.Data)
+		if err != nil || bal < 0 || len(record.Key) == 0 {
+			return errors.New("Balances need a user and a non-negative numeric string")
+		}
+		return setBalance(stub, record.Key, bal)
+	case "marble":
+		var res Marble
+		if err := json.Unmarshal(record.Value, &res); err != nil || len(res.Name) == 0 || len(res.Color) == 0 {
+			return errors.New("Marbles need a name and a color")
+		}
+		if isSystemAccount(res.Name) {
+			return errors.New("Marble names cannot start with _ or be " + reserveStr)
+		}
+		err := putMarble(stub, res, "imported", "")
+		if err != nil {
+			return err
+		}
+		if res.Status == burnedStatus {
+			return addToIndex(stub, burnedIndexStr, res.Name)
+		}
+		return addToIndex(stub, marbleIndexStr, res.Name)
+	case "trade":
+		var trade AnOpenTrade
+		if err := json.Unmarshal(record.Value, &trade); err != nil || len(trade.User) == 0 || len(trade.Willing) == 0 {
+			return errors.New("Trades need a user and at least one willing option")
+		}
+		if pos := findOpenTrade(*trades, trade.Timestamp); pos >= 0 {
+			trades.OpenTrades[pos] = trade
+		} else {
+			trades.OpenTrades = append(trades.OpenTrades, trade)
+		}
+	case "sale":
+		var listing Listing
+		if err := json.Unmarshal(record.Value, &listing); err != nil || len(listing.Marble) == 0 || listing.Price < 0 {
+			return errors.New("Sales need a marble and a non-negative price")
+		}
+		if pos := findListing(*sales, listing.Marble); pos >= 0 {
+			sales.Listings[pos] = listing
+		} else {
+			sales.Listings = append(sales.Listings, listing)
+		}
+	case "auction":
+		var snap AuctionSnapshot
+		if err := json.Unmarshal(record.Value, &snap); err != nil || len(snap.Auction.ID) == 0 {
+			return errors.New("Auctions need an id")
+		}
+		err := putAuction(stub, snap.Auction)
+		if err != nil {
+			return err
+		}
+		for _, bid := range snap.Bids {
+			err = putBid(stub, snap.Auction.ID, bid)
+			if err != nil {
+				return err
+			}
+		}
+		return addToIndex(stub, auctionIndexStr, snap.Auction.ID)
+	case "assettype":
+		var assetType AssetType
+		if err := json.Unmarshal(record.Value, &assetType); err != nil || len(assetType.Name) == 0 || strings.Contains(assetType.Name, "_") {
+			return errors.New("Asset types need a name without _")
+		}
+		jsonAsBytes, _ := json.Marshal(assetType)
+		err := stub.PutState(assetTypePrefix + assetType.Name, jsonAsBytes)
+		if err != nil {
+			return err
+		}
+		return addToIndex(stub, assetTypeIndexStr, assetType.Name)
+	case "asset":
+		var asset Asset
+		if err := json.Unmarshal(record.Value, &asset); err != nil || len(asset.ID) == 0 || len(asset.Owner) == 0 {
+			return errors.New("Assets need an id and an owner")
+		}
+		if assetType, err := getAssetType(stub, asset.Type); err != nil || assetType.Name != asset.Type {	//the type's record comes first
+			return errors.New("Assets need a registered type")
+		}
+		err := putAsset(stub, asset)
+		if err != nil {
+			return err
+		}
+		return addToIndex(stub, assetIndexPrefix + asset.Type, asset.ID)
+	case "assetlookup":
+		var ids []string
+		if err := json.Unmarshal([]byte(record.Data), &ids); err != nil || !strings.HasPrefix(record.Key, assetLookupPrefix) {
+			return errors.New("Asset lookups need a " + assetLookupPrefix + " key and a json list")
+		}
+		return stub.PutState(record.Key, []byte(record.Data))
+	case "assettrade":
+		var trade AnAssetTrade
+		if err := json.Unmarshal(record.Value, &trade); err != nil || len(trade.ID) == 0 || len(trade.User) == 0 {
+			return errors.New("Asset trades need an id and a user")
+		}
+		if pos := findAssetTrade(*assetTrades, trade.ID); pos >= 0 {
+			assetTrades.OpenTrades[pos] = trade
+		} else {
+			assetTrades.OpenTrades = append(assetTrades.OpenTrades, trade)
+		}
+	default:
+		return errors.New("Unknown record kind " + record.Kind)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// checkEmpty - error unless the ledger holds no marbles, accounts, assets, collections or auctions, as after a reset
+// ============================================================================================================================
+func checkEmpty(stub stateStub) error {
+	for _, indexStr := range []string{marbleIndexStr, burnedIndexStr, accountIndexStr, assetTypeIndexStr, collectionIndexStr, auctionIndexStr} {
+		index, err := readIndex(stub, indexStr)
+		if err != nil {
+			return err
+		}
+		if len(index) > 0 {
+			return errors.New("Snapshots can only be imported into an empty ledger, reset it first. " + indexStr + " is not empty")
+		}
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// importIdentities - take the exported user bindings, the ledger's own admins keep the certificates they have here
+// ============================================================================================================================
+func importIdentities(stub stateStub, data string) error {
+	var exported map[string]string
+	json.Unmarshal([]byte(data), &exported)									//un stringify it aka JSON.parse()
+	identities, err := getIdentities(stub)
+	if err != nil {
+		return err
+	}
+	admins, err := readIndex(stub, adminsStr)
+	if err != nil {
+		return err
+	}
+	for _, admin := range admins {
+		delete(exported, admin)
+	}
+	for name, cert := range exported {
+		if _, ok := identities[name]; !ok {
+			identities[name] = cert
+		}
+	}
+	return putIdentities(stub, identities)
+}
+
+// ============================================================================================================================
+// readIndex - read a json list of names
+// ============================================================================================================================
+func readIndex(stub stateStub, indexStr string) ([]string, error) {
+	indexAsBytes, err := stub.GetState(indexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get " + indexStr)
+	}
+	var index []string
+	json.Unmarshal(indexAsBytes, &index)										//un stringify it aka JSON.parse()
+	return index, nil
+}
@@ -0,0 +1,151 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// busyLedger has something of every kind a snapshot carries
+func busyLedger(t *testing.T) *ledger {
+	l := newLedger(t)
+	l.as("deployer")
+	l.must("define_collection", "admin", "blue", "10", "*")
+	l.must("fund_account", "admin", "alice", "50")
+	l.must("init_marble", "m1", "blue", "16", "bob", "admin")
+	l.must("init_marble", "m2", "blue", "35", "bob", "admin")
+	l.must("init_marble", "m3", "red", "16", "alice")
+	l.must("register_asset_type", "admin", "ticket", "event:string:required", "event,owner")
+	l.must("create_asset", "admin", "ticket", "t1", "bob", "event=finals")
+	l.must("create_asset", "admin", "ticket", "t2", "bob", "event=finals")
+	l.must("create_asset", "admin", "ticket", "t3", "alice", "event=semis")
+
+	l.as("bob")
+	l.must("open_trade", "bob", "red", "16", "blue", "16")
+	l.must("list_for_sale", "bob", "m2", "25")
+	l.must("transfer_asset", "ticket", "t1", "bob", "alice")
+	l.must("open_asset_trade", "bob", "ticket", "event=semis", "ticket", "event=finals")
+	l.as("alice")
+	res := l.Run("invoke", "start_auction", []string{"alice", "m3", "english", "10", "3600"})
+	if res.Err != nil {
+		t.Fatal(res.Err)
+	}
+	l.as("deployer")
+	l.must("fund_account", "admin", "bob", "40")
+	l.as("bob")
+	l.must("place_bid", "bob", string(res.Payload), "15")
+	return l
+}
+
+// export reads the whole snapshot in pages of this size
+func (l *ledger) export(size int) []string {
+	l.t.Helper()
+	var pages []string
+	for start := 0; ; start += size {
+		res := l.Run("query", "export_state", []string{strconv.Itoa(start), strconv.Itoa(size)})
+		if res.Err != nil {
+			l.t.Fatal(res.Err)
+		}
+		pages = append(pages, string(res.Payload))
+		var header SnapshotRecord
+		json.Unmarshal(res.Payload[:strings.Index(string(res.Payload), "\n")], &header)
+		if start+size >= header.Total {
+			return pages
+		}
+	}
+}
+
+func TestSnapshotRoundTrip(t *testing.T) {
+	from := busyLedger(t)
+	pages := from.export(4)
+	if len(pages) < 3 {
+		t.Fatalf("%d pages, want a few to check paging", len(pages))
+	}
+	for _, kind := range []string{"asset", "assettype", "assetlookup", "assettrade", "auction", "sale", "trade"} {
+		if !strings.Contains(strings.Join(pages, ""), `"kind":"`+kind+`"`) {
+			t.Fatalf("the snapshot has no %s records", kind)
+		}
+	}
+
+	to := newLedger(t)
+	to.as("deployer")
+	for _, page := range pages {
+		to.must("import_state", "admin", page)
+	}
+	if again := to.export(4); strings.Join(again, "") != strings.Join(pages, "") {
+		t.Fatalf("export after import differs:\n%s\nwant:\n%s", strings.Join(again, ""), strings.Join(pages, ""))
+	}
+
+	var assets []Asset
+	to.query(&assets, "list_assets", "ticket", "owner", "alice")
+	if len(assets) != 2 || assets[0].ID != "t3" || assets[1].ID != "t1" {
+		t.Fatalf("alice's tickets %+v, want t3 then t1", assets)
+	}
+}
+
+func TestSnapshotPagesMustFollowOn(t *testing.T) {
+	from := busyLedger(t)
+	pages := from.export(4)
+
+	to := newLedger(t)
+	to.as("deployer")
+	to.fails("Expecting the page starting at 0", "import_state", "admin", pages[1])
+	to.must("import_state", "admin", pages[0])
+	to.fails("Expecting the page starting at 4", "import_state", "admin", pages[2])
+
+	from.as("deployer")
+	from.must("init_marble", "m4", "green", "16", "bob")
+	changed := from.export(4)
+	to.fails("different export", "import_state", "admin", changed[1])
+	to.must("import_state", "admin", pages[1])
+}
+
+func TestImportKeepsTheTargetsAdmins(t *testing.T) {
+	from := busyLedger(t)
+	from.as("bob")
+	from.must("register_user", "bob")
+	pages := from.export(4)
+
+	to := newLedgerAs(t, "ops")
+	for _, page := range pages {
+		to.must("import_state", "admin", page)
+	}
+	to.must("fund_account", "admin", "carol", "5")
+	to.as("deployer")
+	to.fails("The caller is not admin", "fund_account", "admin", "carol", "5")
+	to.as("eve")
+	to.fails("The caller is not bob", "burn_marble", "m1", "bob")
+	to.as("bob")
+	to.must("burn_marble", "m1", "bob")
+}
+
+func TestImportNeedsAnEmptyLedger(t *testing.T) {
+	pages := busyLedger(t).export(4)
+
+	to := newLedger(t)
+	to.as("deployer")
+	to.must("init_marble", "m9", "green", "16", "carol")
+	to.fails("empty ledger", "import_state", "admin", pages[0])
+	to.Run("init", "init", []string{"1000", "admin"})
+	to.must("import_state", "admin", pages[0])
+}
@@ -0,0 +1,275 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var reserveStr = "abc"						//the asset holding Init seeds is the reserve every account is funded from
+var totalSupplyStr = "_totalsupply"			//name for the key/value that will store how many tokens exist
+var balancePrefix = "_balance_"				//prefix for the key/value that stores a user's token balance
+var accountIndexStr = "_accountindex"		//name for the key/value that will store a list of every user with a balance
+
+// ============================================================================================================================
+// Fund Account - admins move tokens out of the "abc" reserve into a user's balance
+// ============================================================================================================================
+func (t *SimpleChaincode) fund_account(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0		1		2
+	//["admin", "bob", "50"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start fund account")
+	err = requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args[1]) <= 0 || isSystemAccount(args[1]) {
+		return nil, errors.New("2nd argument must be a user")
+	}
+	amount, err := strconv.Atoi(args[2])
+	if err != nil || amount <= 0 {
+		return nil, errors.New("3rd argument must be a positive numeric string")
+	}
+	err = moveTokens(stub, reserveStr, args[1], amount)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end fund account")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Mint - admins create new tokens in a user's balance, growing the total supply
+// ============================================================================================================================
+func (t *SimpleChaincode) mint(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0		1		2
+	//["admin", "bob", "50"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start mint")
+	err = requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args[1]) <= 0 || isSystemAccount(args[1]) {
+		return nil, errors.New("2nd argument must be a user")
+	}
+	amount, err := strconv.Atoi(args[2])
+	if err != nil || amount <= 0 {
+		return nil, errors.New("3rd argument must be a positive numeric string")
+	}
+
+	supply, err := getTotalSupply(stub)
+	if err != nil {
+		return nil, err
+	}
+	err = stub.PutState(totalSupplyStr, []byte(strconv.Itoa(supply + amount)))
+	if err != nil {
+		return nil, err
+	}
+	bal, err := getBalance(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	err = setBalance(stub, args[1], bal + amount)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end mint")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Transfer - send tokens from one user's balance to another's, only the caller bound to the from user may send them
+// ============================================================================================================================
+func (t *SimpleChaincode) transfer(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0		1		2
+	//["bob", "alice", "10"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start transfer")
+	err = checkActor(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if len(args[1]) <= 0 || isSystemAccount(args[1]) {
+		return nil, errors.New("2nd argument must be a user")
+	}
+	amount, err := strconv.Atoi(args[2])
+	if err != nil || amount <= 0 {
+		return nil, errors.New("3rd argument must be a positive numeric string")
+	}
+	err = moveTokens(stub, args[0], args[1], amount)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end transfer")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Balance Of - read a user's token balance
+// ============================================================================================================================
+func (t *SimpleChaincode) balance_of(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting name of the user to query")
+	}
+
+	bal, err := getBalance(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.Itoa(bal)), nil
+}
+
+// ============================================================================================================================
+// Total Supply - read how many tokens exist, reserve included
+// ============================================================================================================================
+func (t *SimpleChaincode) total_supply(stub stateStub, args []string) ([]byte, error) {
+	supply, err := getTotalSupply(stub)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.Itoa(supply)), nil
+}
+
+// ============================================================================================================================
+// getTotalSupply - read the total supply, stored as a numeric string just like "abc"
+// ============================================================================================================================
+func getTotalSupply(stub stateStub) (int, error) {
+	supplyAsBytes, err := stub.GetState(totalSupplyStr)
+	if err != nil {
+		return 0, errors.New("Failed to get total supply")
+	}
+	if len(supplyAsBytes) == 0 {
+		return 0, nil
+	}
+	supply, err := strconv.Atoi(string(supplyAsBytes))
+	if err != nil {
+		return 0, errors.New("Total supply is not a numeric string")
+	}
+	return supply, nil
+}
+
+// ============================================================================================================================
+// isSystemAccount - the reserve and "_" accounts like the auction escrow only move through the invokes that own them
+// ============================================================================================================================
+func isSystemAccount(user string) bool {
+	user = strings.ToLower(user)
+	return user == reserveStr || strings.HasPrefix(user, "_")
+}
+
+// ============================================================================================================================
+// checkActor - error unless the caller may act for this user, spending their tokens or moving their marbles.
+// Nobody may act as a system account, the escrow only moves through the auction invokes
+// ============================================================================================================================
+func checkActor(stub stateStub, user string) error {
+	if isSystemAccount(user) {
+		return errors.New(user + " is a system account")
+	}
+	return checkCaller(stub, user)
+}
+
+// ============================================================================================================================
+// moveTokens - debit one balance and credit another, fails if the debited account would go negative
+// ============================================================================================================================
+func moveTokens(stub stateStub, from string, to string, amount int) error {
+	fromBal, err := getBalance(stub, from)
+	if err != nil {
+		return err
+	}
+	if fromBal < amount {
+		return errors.New("Insufficient balance for " + from + ", has " + strconv.Itoa(fromBal) + " needs " + strconv.Itoa(amount))
+	}
+	err = setBalance(stub, from, fromBal - amount)
+	if err != nil {
+		return err
+	}
+	toBal, err := getBalance(stub, to)
+	if err != nil {
+		return err
+	}
+	return setBalance(stub, to, toBal + amount)
+}
+
+// ============================================================================================================================
+// balanceKey - the reserve lives in "abc", every other account under the balance prefix
+// ============================================================================================================================
+func balanceKey(user string) string {
+	if user == reserveStr {
+		return reserveStr
+	}
+	return balancePrefix + strings.ToLower(user)
+}
+
+// ============================================================================================================================
+// getBalance - read a token balance, accounts that were never funded hold 0
+// ============================================================================================================================
+func getBalance(stub stateStub, user string) (int, error) {
+	balAsBytes, err := stub.GetState(balanceKey(user))
+	if err != nil {
+		return 0, errors.New("Failed to get balance for " + user)
+	}
+	if len(balAsBytes) == 0 {
+		return 0, nil
+	}
+	bal, err := strconv.Atoi(string(balAsBytes))
+	if err != nil {
+		return 0, errors.New("Balance for " + user + " is not a numeric string")
+	}
+	return bal, nil
+}
+
+// ============================================================================================================================
+// setBalance - write a token balance, stored as a numeric string just like "abc"
+// ============================================================================================================================
+func setBalance(stub stateStub, user string, bal int) error {
+	balAsBytes, err := stub.GetState(balanceKey(user))
+	if err != nil {
+		return errors.New("Failed to get balance for " + user)
+	}
+	if len(balAsBytes) == 0 && user != reserveStr {							//first time we see this account
+		err = addToIndex(stub, accountIndexStr, strings.ToLower(user))
+		if err != nil {
+			return err
+		}
+	}
+	return stub.PutState(balanceKey(user), []byte(strconv.Itoa(bal)))
+}
@@ -0,0 +1,212 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"encoding/json"
+	"strings"
+)
+
+var tradeBucketsStr = "_tradebuckets"		//name for the key/value that maps owner/color/size buckets to the open trades offering them
+
+// ============================================================================================================================
+// putOpenTrades - rewrite the open trades and the bucket index that points at them
+// ============================================================================================================================
+func putOpenTrades(stub stateStub, trades AllTrades) error {
+	jsonAsBytes, _ := json.Marshal(trades)
+	err := stub.PutState(openTradesStr, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+
+	buckets := map[string][]int64{}
+	for _, trade := range trades.OpenTrades {
+		for _, option := range trade.Willing {
+			bucket := tradeBucket(trade.User, option)
+			ids := buckets[bucket]
+			if len(ids) == 0 || ids[len(ids)-1] != trade.Timestamp {			//an opener may offer the same bucket twice
+				buckets[bucket] = append(ids, trade.Timestamp)
+			}
+		}
+	}
+	jsonAsBytes, _ = json.Marshal(buckets)
+	return stub.PutState(tradeBucketsStr, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// tradesInBuckets - ids of the open trades offering a marble from any of these buckets
+// ============================================================================================================================
+func tradesInBuckets(stub stateStub, touched map[string]bool) (map[int64]bool, error) {
+	bucketsAsBytes, err := stub.GetState(tradeBucketsStr)
+	if err != nil {
+		return nil, errors.New("Failed to get trade buckets")
+	}
+	var buckets map[string][]int64
+	json.Unmarshal(bucketsAsBytes, &buckets)									//un stringify it aka JSON.parse()
+
+	ids := map[int64]bool{}
+	for bucket := range touched {
+		for _, id := range buckets[bucket] {
+			ids[id] = true
+		}
+	}
+	return ids, nil
+}
+
+// ============================================================================================================================
+// tradeBucket - bucket of the marbles an opener could use for this option
+// ============================================================================================================================
+func tradeBucket(user string, option Description) string {
+	return marbleBucket(Marble{User: user, Color: option.Color, Size: option.Size})
+}
+
+// ============================================================================================================================
+// marbleBucket - owner/color/size bucket a marble is in
+// ============================================================================================================================
+func marbleBucket(res Marble) string {
+	return strings.ToLower(res.User) + "_" + strings.ToLower(res.Color) + "_" + strconv.Itoa(res.Size)
+}
+
+// ============================================================================================================================
+// touchMarble - note a marble is leaving its owner, call before the owner changes
+// ============================================================================================================================
+func touchMarble(stub stateStub, res Marble) {
+	if c, ok := stub.(*txCache); ok {
+		c.touched[marbleBucket(res)] = true
+	}
+}
+
+// ============================================================================================================================
+// touchAll - note a change that could affect any open trade
+// ============================================================================================================================
+func touchAll(stub stateStub) {
+	if c, ok := stub.(*txCache); ok {
+		c.touchedAll = true
+	}
+}
+
+// ============================================================================================================================
+// takeTouched - buckets touched since the last clean, and whether every trade needs a look. Starts the next clean afresh
+// ============================================================================================================================
+func takeTouched(stub stateStub) (map[string]bool, bool) {
+	c, ok := stub.(*txCache)
+	if !ok {																	//no cache, no tracking, check everything
+		return nil, true
+	}
+	touched, all := c.touched, c.touchedAll
+	c.touched = map[string]bool{}
+	c.touchedAll = false
+	return touched, all
+}
+
+// tradeBook - the open trades of one kind, marbles or registry assets, as dropUncovered walks them
+type tradeBook interface {
+	Trades() int
+	Options(i int) int
+	Covered(i int, x int) bool											//the opener still owns something for this willing option
+	DropOption(i int, x int)
+	DropTrade(i int)
+}
+
+// ============================================================================================================================
+// dropUncovered - remove willing options the opener can no longer cover, and trades with none left. True if anything changed
+// ============================================================================================================================
+func dropUncovered(book tradeBook) bool {
+	didWork := false
+	for i := 0; i < book.Trades(); i++ {
+		for x := 0; x < book.Options(i); x++ {
+			if !book.Covered(i, x) {
+				didWork = true
+				book.DropOption(i, x)
+				x--
+			}
+		}
+		if book.Options(i) == 0 {
+			didWork = true
+			book.DropTrade(i)
+			i--
+		}
+	}
+	return didWork
+}
+
+// ============================================================================================================================
+// findInIndex - call match on each name of a json list of names until it returns true, false if none did
+// ============================================================================================================================
+func findInIndex(stub stateStub, indexStr string, match func(name string) (bool, error)) (bool, error) {
+	indexAsBytes, err := stub.GetState(indexStr)
+	if err != nil {
+		return false, errors.New("Failed to get index " + indexStr)
+	}
+	var index []string
+	json.Unmarshal(indexAsBytes, &index)										//un stringify it aka JSON.parse()
+	for _, name := range index {
+		ok, err := match(name)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// marbleTrades - open marble trades, when not all are checked only options in a touched bucket are looked at again
+type marbleTrades struct {
+	stub stateStub
+	trades *AllTrades
+	all bool
+	check map[int64]bool													//trades offering a touched bucket
+	buckets map[string]bool
+}
+
+func (b *marbleTrades) Trades() int { return len(b.trades.OpenTrades) }
+func (b *marbleTrades) Options(i int) int { return len(b.trades.OpenTrades[i].Willing) }
+func (b *marbleTrades) DropOption(i int, x int) { removeWillingOption(&b.trades.OpenTrades[i], x) }
+func (b *marbleTrades) DropTrade(i int) { b.trades.OpenTrades = append(b.trades.OpenTrades[:i], b.trades.OpenTrades[i+1:]...) }
+
+func (b *marbleTrades) Covered(i int, x int) bool {
+	trade := b.trades.OpenTrades[i]
+	if !b.all && (!b.check[trade.Timestamp] || !b.buckets[tradeBucket(trade.User, trade.Willing[x])]) {
+		return true															//nothing in its bucket changed hands
+	}
+	_, e := findMarble4Trade(b.stub, trade.User, trade.Willing[x])
+	return e == nil
+}
+
+// assetTrades - open registry asset trades, every option is looked at again
+type assetTrades struct {
+	stub stateStub
+	trades *AllAssetTrades
+}
+
+func (b *assetTrades) Trades() int { return len(b.trades.OpenTrades) }
+func (b *assetTrades) Options(i int) int { return len(b.trades.OpenTrades[i].Willing) }
+func (b *assetTrades) DropTrade(i int) { b.trades.OpenTrades = append(b.trades.OpenTrades[:i], b.trades.OpenTrades[i+1:]...) }
+
+func (b *assetTrades) DropOption(i int, x int) {
+	b.trades.OpenTrades[i].Willing = append(b.trades.OpenTrades[i].Willing[:x], b.trades.OpenTrades[i].Willing[x+1:]...)
+}
+
+func (b *assetTrades) Covered(i int, x int) bool {
+	_, e := findAsset4Trade(b.stub, b.trades.OpenTrades[i].User, b.trades.OpenTrades[i].Willing[x])
+	return e == nil
+}
@@ -0,0 +1,51 @@
+//go:build marblesim
+// +build marblesim
+
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"github.com/randyramnansingh/marbles-chaincode/sim"
+)
+
+// ============================================================================================================================
+// Main - built with -tags marblesim this chaincode runs in the local simulator instead of on a peer
+// ============================================================================================================================
+func main() {
+	sim.Main("hyperledger/part1", simChaincode{})
+}
+
+// simChaincode hands the simulator's stub to the same entry points the shim uses
+type simChaincode struct{
+	t SimpleChaincode
+}
+
+func (c simChaincode) Init(stub *sim.Stub, args []string) ([]byte, error) {
+	return c.t.reset(stub, args)
+}
+
+func (c simChaincode) Invoke(stub *sim.Stub, function string, args []string) ([]byte, error) {
+	return c.t.invoke(stub, function, args)
+}
+
+func (c simChaincode) Query(stub *sim.Stub, function string, args []string) ([]byte, error) {
+	return c.t.query(stub, function, args)
+}
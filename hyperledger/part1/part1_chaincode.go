@@ -27,6 +27,7 @@ import (
 	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/randyramnansingh/marbles-chaincode/txlog"
 )
 
 // SimpleChaincode example simple Chaincode implementation
@@ -36,6 +37,13 @@ type SimpleChaincode struct {
 var marbleIndexStr = "_marbleindex"				//name for the key/value that will store a list of all known marbles
 var openTradesStr = "_opentrades"				//name for the key/value that will store all open trades
 
+// stateStub is the part of the shim the handlers use, so they also run in the simulator
+type stateStub interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+	DelState(key string) error
+}
+
 type Marble struct{
 	Name string `json:"name"`					//the fieldtags are needed to keep case from bouncing around
 	Color string `json:"color"`
@@ -44,19 +52,18 @@ type Marble struct{
 }
 
 // ============================================================================================================================
-// Main
+// Init - reset all the things
 // ============================================================================================================================
-func main() {
-	err := shim.Start(new(SimpleChaincode))
-	if err != nil {
-		fmt.Printf("Error starting Simple chaincode: %s", err)
-	}
+func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	res, err := t.reset(stub, args)
+	txlog.Record(stub, "init", function, args, res, err)						//no-op unless MARBLES_TXLOG is set
+	return res, err
 }
 
 // ============================================================================================================================
-// Init - reset all the things
+// reset - write the starting state, also used by the "init" invoke
 // ============================================================================================================================
-func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+func (t *SimpleChaincode) reset(stub stateStub, args []string) ([]byte, error) {
 	var Aval int
 	var err error
 
@@ -98,11 +105,20 @@ func (t *SimpleChaincode) Run(stub *shim.ChaincodeStub, function string, args []
 // Invoke - Our entry point for Invocations
 // ============================================================================================================================
 func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	res, err := t.invoke(stub, function, args)
+	txlog.Record(stub, "invoke", function, args, res, err)
+	return res, err
+}
+
+// ============================================================================================================================
+// invoke - run one invocation against the stub
+// ============================================================================================================================
+func (t *SimpleChaincode) invoke(stub stateStub, function string, args []string) ([]byte, error) {
 	fmt.Println("invoke is running " + function)
 
 	// Handle different functions
 	if function == "init" {													//initialize the chaincode state, used as reset
-		return t.Init(stub, "init", args)
+		return t.reset(stub, args)
 	} else if function == "delete" {										//deletes an entity from its state
 		return t.Delete(stub, args)
 	} else if function == "write" {											//writes a value to the chaincode state
@@ -121,6 +137,15 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 // Query - Our entry point for Queries
 // ============================================================================================================================
 func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	res, err := t.query(stub, function, args)
+	txlog.Record(stub, "query", function, args, res, err)
+	return res, err
+}
+
+// ============================================================================================================================
+// query - run one query against the stub
+// ============================================================================================================================
+func (t *SimpleChaincode) query(stub stateStub, function string, args []string) ([]byte, error) {
 	fmt.Println("query is running " + function)
 
 	// Handle different functions
@@ -135,7 +160,7 @@ func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args
 // ============================================================================================================================
 // Read - read a variable from chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) read(stub stateStub, args []string) ([]byte, error) {
 	var name, jsonResp string
 	var err error
 
@@ -156,7 +181,7 @@ func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte,
 // ============================================================================================================================
 // Delete - remove a key/value pair from state
 // ============================================================================================================================
-func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) Delete(stub stateStub, args []string) ([]byte, error) {
 	if len(args) != 1 {
 		return nil, errors.New("Incorrect number of arguments. Expecting 1")
 	}
@@ -182,7 +207,7 @@ func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byt
 			fmt.Println("found marble")
 			marbleIndex = append(marbleIndex[:i], marbleIndex[i+1:]...)			//remove it
 			for x:= range marbleIndex{											//debug prints...
-				fmt.Println(string(x) + " - " + marbleIndex[x])
+				fmt.Println(strconv.Itoa(x) + " - " + marbleIndex[x])
 			}
 			break
 		}
@@ -195,7 +220,7 @@ func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byt
 // ============================================================================================================================
 // Write - write variable into chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) Write(stub stateStub, args []string) ([]byte, error) {
 	var name, value string // Entities
 	var err error
 	fmt.Println("running write()")
@@ -216,7 +241,7 @@ func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte
 // ============================================================================================================================
 // Init Marble - create a new marble, store into chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) init_marble(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) init_marble(stub stateStub, args []string) ([]byte, error) {
 	var err error
 
 	//   0       1       2     3
@@ -274,7 +299,7 @@ func (t *SimpleChaincode) init_marble(stub *shim.ChaincodeStub, args []string) (
 // ============================================================================================================================
 // Set User Permission on Marble
 // ============================================================================================================================
-func (t *SimpleChaincode) set_user(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) set_user(stub stateStub, args []string) ([]byte, error) {
 	var err error
 	
 	//   0       1
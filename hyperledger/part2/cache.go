@@ -0,0 +1,131 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"sort"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// stateStub is the part of the shim every handler uses, a *shim.ChaincodeStub or a txCache over one
+type stateStub interface {
+	GetState(key string) ([]byte, error)
+	PutState(key string, value []byte) error
+	DelState(key string) error
+	GetTxID() string
+	GetTxTimestamp() (*timestamp.Timestamp, error)
+	SetEvent(name string, payload []byte) error
+	GetCallerCertificate() ([]byte, error)
+}
+
+type cacheEntry struct{
+	value []byte
+	deleted bool
+	dirty bool								//written since it was read, flush must send it on
+}
+
+// txCache serves repeated reads from memory and holds writes until flush, so a failed invocation writes nothing
+type txCache struct{
+	stateStub
+	entries map[string]*cacheEntry
+	events map[string][]byte
+}
+
+// ============================================================================================================================
+// newTxCache - start an empty cache over a stub
+// ============================================================================================================================
+func newTxCache(stub stateStub) *txCache {
+	return &txCache{stateStub: stub, entries: map[string]*cacheEntry{}, events: map[string][]byte{}}
+}
+
+// ============================================================================================================================
+// GetState - read from the cache, falling back to the stub the first time a key is seen
+// ============================================================================================================================
+func (c *txCache) GetState(key string) ([]byte, error) {
+	if entry, ok := c.entries[key]; ok {
+		return entry.value, nil
+	}
+	value, err := c.stateStub.GetState(key)
+	if err != nil {
+		return nil, err
+	}
+	c.entries[key] = &cacheEntry{value: value}
+	return value, nil
+}
+
+// ============================================================================================================================
+// PutState - remember a write, only the last write to a key reaches the stub
+// ============================================================================================================================
+func (c *txCache) PutState(key string, value []byte) error {
+	c.entries[key] = &cacheEntry{value: value, dirty: true}
+	return nil
+}
+
+// ============================================================================================================================
+// DelState - remember a delete, reads see the key as empty until flush
+// ============================================================================================================================
+func (c *txCache) DelState(key string) error {
+	c.entries[key] = &cacheEntry{deleted: true, dirty: true}
+	return nil
+}
+
+// ============================================================================================================================
+// SetEvent - hold the event until flush, the shim only keeps one event per transaction so the last one wins
+// ============================================================================================================================
+func (c *txCache) SetEvent(name string, payload []byte) error {
+	c.events = map[string][]byte{name: payload}
+	return nil
+}
+
+// ============================================================================================================================
+// flush - send every write and the event on to the stub, in key order so each peer writes the same way
+// ============================================================================================================================
+func (c *txCache) flush() error {
+	var keys []string
+	for key, entry := range c.entries {
+		if entry.dirty {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		entry := c.entries[key]
+		var err error
+		if entry.deleted {
+			err = c.stateStub.DelState(key)
+		} else {
+			err = c.stateStub.PutState(key, entry.value)
+		}
+		if err != nil {
+			return err
+		}
+		entry.dirty = false
+	}
+	for name, payload := range c.events {
+		err := c.stateStub.SetEvent(name, payload)
+		if err != nil {
+			return err
+		}
+	}
+	c.events = map[string][]byte{}
+	return nil
+}
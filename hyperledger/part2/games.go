@@ -0,0 +1,499 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"strings"
+)
+
+var gameIndexStr = "_gameindex"				//name for the key/value that will store a list of all known games
+var gamePrefix = "_game_"					//prefix for the key/value that stores a game
+var balancePrefix = "_balance_"				//prefix for the key/value that stores a user's tokens
+var reserveStr = "abc"						//the asset holding Init seeds is the reserve every participant is funded from
+var participantIndexStr = "_participantindex"	//name for the key/value that will store a list of all registered participants
+
+type Game struct{
+	ID string `json:"id"`
+	Status string `json:"status"`				//"open", "locked", "reported", "disputed", "resolved", "cancelled" or "void"
+	Sides []string `json:"sides"`				//sides a bet can back
+	Winner string `json:"winner"`				//winning side once resolved
+	Bets []string `json:"bets"`				//names of the bets placed on this game
+	Pot int `json:"pot"`						//total of every wager on this game
+	Pools map[string]int `json:"pools"`		//total wagered on each side
+	Mode string `json:"mode"`				//"parimutuel" or "fixed"
+	HouseCut int `json:"house_cut"`			//percent of a pari-mutuel pot kept by the house
+	FixedOdds map[string]int `json:"fixed_odds"`	//fixed mode - decimal odds per side in hundredths, 250 pays 2.50 per 1 staked
+	Liability map[string]int `json:"liability,omitempty"`	//fixed mode - what the bets on each side are owed if it wins
+	Round int `json:"round"`					//oracle report round, goes up each time a result is overturned
+	Reports map[string]string `json:"reports"`	//signed result each oracle submitted, oracle -> side
+	Reported string `json:"reported"`		//side that reached the oracle threshold
+	DisputeEnd int64 `json:"dispute_end"`	//tx time in seconds after which the reported side can be paid out
+	Disputes []Dispute `json:"disputes"`
+	Paid int `json:"paid"`					//total paid to winning bets once resolved
+	HouseTake int `json:"house_take"`		//what the house kept, negative if fixed odds cost it
+}
+
+// ============================================================================================================================
+// Create Game - admins open a new game that bets can be placed on
+// ============================================================================================================================
+func (t *SimpleChaincode) create_game(stub stateStub, args []string) ([]byte, error) {
+	var err error
+
+	//	0		1		2		3		4...
+	//["admin", "game", "red", "blue", "green"...]   - sides default to player "1" and "2"
+	if len(args) < 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting at least 2")
+	}
+	if len(args[1]) <= 0 {
+		return nil, errors.New("2nd argument must be a non-empty string")
+	}
+
+	fmt.Println("- start create game")
+	err = requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if _, e := getGame(stub, args[1]); e == nil {
+		return nil, errors.New("This game already exists")
+	}
+	game := Game{ID: args[1], Status: "open", Sides: []string{"1", "2"}, Mode: "parimutuel", Pools: map[string]int{}, FixedOdds: map[string]int{}}
+	if len(args) > 2 {
+		if len(args) < 4 {
+			return nil, errors.New("A game needs at least 2 sides")
+		}
+		game.Sides = nil
+		for _, side := range args[2:] {
+			if len(side) <= 0 || hasSide(game, side) {
+				return nil, errors.New("Sides must be unique non-empty strings")
+			}
+			game.Sides = append(game.Sides, side)
+		}
+	}
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	//get the game index
+	gamesAsBytes, err := stub.GetState(gameIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get game index")
+	}
+	var gameIndex []string
+	json.Unmarshal(gamesAsBytes, &gameIndex)									//un stringify it aka JSON.parse()
+	gameIndex = append(gameIndex, game.ID)
+	jsonAsBytes, _ := json.Marshal(gameIndex)
+	err = stub.PutState(gameIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end create game")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Register Participant - add a named participant who can place and hold bets
+// ============================================================================================================================
+func (t *SimpleChaincode) register_participant(stub stateStub, args []string) ([]byte, error) {
+	//	0
+	//["bob"]
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+	if len(args[0]) <= 0 {
+		return nil, errors.New("1st argument must be a non-empty string")
+	}
+
+	fmt.Println("- start register participant")
+	name := strings.ToLower(args[0])
+	participants, err := getParticipants(stub)
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range participants {
+		if p == name {
+			return nil, errors.New("This participant is already registered")
+		}
+	}
+	participants = append(participants, name)
+	jsonAsBytes, _ := json.Marshal(participants)
+	err = stub.PutState(participantIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = bindCaller(stub, name)											//from now on only this caller may bet as them
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end register participant")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Fund Participant - admins move tokens out of the "abc" reserve so a participant can place bets, or the house can back odds
+// ============================================================================================================================
+func (t *SimpleChaincode) fund_participant(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2
+	//["admin", "bob", "50"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start fund participant")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	user := strings.ToLower(args[1])
+	if user != houseStr && !isParticipant(stub, user) {						//the house needs tokens to back fixed odds
+		return nil, errors.New("2nd argument must be a registered participant or " + houseStr)
+	}
+	amount, err := strconv.Atoi(args[2])
+	if err != nil || amount <= 0 {
+		return nil, errors.New("3rd argument must be a positive numeric string")
+	}
+
+	reserveAsBytes, err := stub.GetState(reserveStr)
+	if err != nil {
+		return nil, errors.New("Failed to get the reserve")
+	}
+	reserve, err := strconv.Atoi(string(reserveAsBytes))
+	if err != nil {
+		return nil, errors.New("The reserve is not a numeric string")
+	}
+	if reserve < amount {
+		return nil, errors.New("The reserve only holds " + strconv.Itoa(reserve))
+	}
+	err = stub.PutState(reserveStr, []byte(strconv.Itoa(reserve - amount)))
+	if err != nil {
+		return nil, err
+	}
+	err = credit(stub, user, amount)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end fund participant")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Lock Game - admins stop taking bets, usually when the game starts
+// ============================================================================================================================
+func (t *SimpleChaincode) lock_game(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["admin", "game"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start lock game")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	game, err := getGame(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "open" {
+		return nil, errors.New("Only an open game can be locked")
+	}
+	game.Status = "locked"
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end lock game")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Resolve Game - once the dispute window on the oracles' result has passed, record the winning side and pay out
+// ============================================================================================================================
+func (t *SimpleChaincode) resolve_game(stub stateStub, args []string) ([]byte, error) {
+	//	0
+	//["game"]
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	fmt.Println("- start resolve game")
+	game, err := getGame(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "reported" {
+		return nil, errors.New("Game has no undisputed oracle result, it is " + game.Status)
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	if now < game.DisputeEnd {
+		return nil, errors.New("Result can still be disputed until " + strconv.FormatInt(game.DisputeEnd, 10))
+	}
+	game.Status = "resolved"
+	game.Winner = game.Reported
+
+	err = payoutGame(stub, &game)
+	if err != nil {
+		return nil, err
+	}
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end resolve game")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Cancel Game - call off a game that has no bets on it yet
+// ============================================================================================================================
+func (t *SimpleChaincode) cancel_game(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["admin", "game"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start cancel game")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	game, err := getGame(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "open" && game.Status != "locked" {
+		return nil, errors.New("Game has already been " + game.Status)
+	}
+	if len(game.Bets) > 0 {
+		return nil, errors.New("Game already has bets on it")
+	}
+	game.Status = "cancelled"
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end cancel game")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Read Game - read a game by id
+// ============================================================================================================================
+func (t *SimpleChaincode) read_game(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	game, err := getGame(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(game)
+}
+
+// ============================================================================================================================
+// Balance - read how much a user has been paid out
+// ============================================================================================================================
+func (t *SimpleChaincode) balance(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting name of the user to query")
+	}
+
+	bal, err := getBalance(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return []byte(strconv.Itoa(bal)), nil
+}
+
+// ============================================================================================================================
+// payoutGame - pay each bet on the game what settleBet says it won, the house keeps whatever is left of the pot
+// ============================================================================================================================
+func payoutGame(stub stateStub, game *Game) error {
+	var bets []Bet
+	for _, name := range game.Bets {
+		betAsBytes, err := stub.GetState(name)
+		if err != nil {
+			return errors.New("Failed to get bet " + name)
+		}
+		bet := Bet{}
+		json.Unmarshal(betAsBytes, &bet)										//un stringify it aka JSON.parse()
+		if bet.Name != name {													//bet was deleted
+			continue
+		}
+		bets = append(bets, bet)
+	}
+
+	paid := 0
+	for _, bet := range bets {
+		bet.Payout = settleBet(*game, bet)
+		paid += bet.Payout
+		fmt.Println("! paying " + bet.User + " " + strconv.Itoa(bet.Payout) + " for " + bet.Name)
+
+		err := recordSettled(stub, bet)
+		if err != nil {
+			return err
+		}
+
+		if bet.Payout > 0 {
+			err = credit(stub, bet.User, bet.Payout)
+			if err != nil {
+				return err
+			}
+		}
+		jsonAsBytes, _ := json.Marshal(bet)
+		err = stub.PutState(bet.Name, jsonAsBytes)								//rewrite the bet with its payout
+		if err != nil {
+			return err
+		}
+	}
+
+	game.Paid = paid
+	game.HouseTake = game.Pot - paid
+	fmt.Println("! house takes " + strconv.Itoa(game.HouseTake))
+	if game.HouseTake < 0 {
+		return debit(stub, houseStr, -game.HouseTake)							//the loss on fixed odds, never more than the house holds
+	}
+	return credit(stub, houseStr, game.HouseTake)								//cut and rounding
+}
+
+// ============================================================================================================================
+// isParticipant - true if this name has been registered
+// ============================================================================================================================
+func isParticipant(stub stateStub, name string) bool {
+	participants, err := getParticipants(stub)
+	if err != nil {
+		return false
+	}
+	for _, p := range participants {
+		if p == strings.ToLower(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// getParticipants - read every registered participant
+// ============================================================================================================================
+func getParticipants(stub stateStub) ([]string, error) {
+	var participants []string
+	participantsAsBytes, err := stub.GetState(participantIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get participant index")
+	}
+	json.Unmarshal(participantsAsBytes, &participants)							//un stringify it aka JSON.parse()
+	return participants, nil
+}
+
+// ============================================================================================================================
+// hasSide - true if a bet can back this side of the game
+// ============================================================================================================================
+func hasSide(game Game, side string) bool {
+	for _, s := range game.Sides {
+		if s == side {
+			return true
+		}
+	}
+	return false
+}
+
+// ============================================================================================================================
+// getGame - read a game by id
+// ============================================================================================================================
+func getGame(stub stateStub, id string) (Game, error) {
+	game := Game{}
+	gameAsBytes, err := stub.GetState(gamePrefix + id)
+	if err != nil {
+		return game, errors.New("Failed to get game")
+	}
+	json.Unmarshal(gameAsBytes, &game)											//un stringify it aka JSON.parse()
+	if game.ID != id {
+		return game, errors.New("Did not find game " + id)
+	}
+	return game, nil
+}
+
+// ============================================================================================================================
+// putGame - rewrite a game
+// ============================================================================================================================
+func putGame(stub stateStub, game Game) error {
+	jsonAsBytes, _ := json.Marshal(game)
+	return stub.PutState(gamePrefix + game.ID, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// credit - add tokens to a user's balance
+// ============================================================================================================================
+func credit(stub stateStub, user string, amount int) error {
+	bal, err := getBalance(stub, user)
+	if err != nil {
+		return err
+	}
+	return stub.PutState(balancePrefix + user, []byte(strconv.Itoa(bal + amount)))
+}
+
+// ============================================================================================================================
+// debit - take tokens from a user's balance, fails if they do not have enough
+// ============================================================================================================================
+func debit(stub stateStub, user string, amount int) error {
+	bal, err := getBalance(stub, user)
+	if err != nil {
+		return err
+	}
+	if bal < amount {
+		return errors.New("Insufficient balance for " + user + ", has " + strconv.Itoa(bal) + " needs " + strconv.Itoa(amount))
+	}
+	return stub.PutState(balancePrefix + user, []byte(strconv.Itoa(bal - amount)))
+}
+
+// ============================================================================================================================
+// getBalance - read a user's balance, users that were never paid hold 0
+// ============================================================================================================================
+func getBalance(stub stateStub, user string) (int, error) {
+	balAsBytes, err := stub.GetState(balancePrefix + user)
+	if err != nil {
+		return 0, errors.New("Failed to get balance for " + user)
+	}
+	if len(balAsBytes) == 0 {
+		return 0, nil
+	}
+	bal, err := strconv.Atoi(string(balAsBytes))
+	if err != nil {
+		return 0, errors.New("Balance for " + user + " is not a numeric string")
+	}
+	return bal, nil
+}
@@ -0,0 +1,126 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/randyramnansingh/marbles-chaincode/sim"
+)
+
+// testChaincode hands the simulator's stub to the same entry points the shim uses, like main_sim.go
+type testChaincode struct {
+	t SimpleChaincode
+}
+
+func (c testChaincode) Init(stub *sim.Stub, args []string) ([]byte, error) {
+	return c.t.reset(stub, args)
+}
+
+func (c testChaincode) Invoke(stub *sim.Stub, function string, args []string) ([]byte, error) {
+	return c.t.invokeTx(stub, function, args)
+}
+
+func (c testChaincode) Query(stub *sim.Stub, function string, args []string) ([]byte, error) {
+	return c.t.query(newTxCache(stub), function, args)
+}
+
+// ledger is a simulator session that fails the test when a step does not go as expected
+type ledger struct {
+	*sim.Session
+	t *testing.T
+}
+
+// newLedger deploys the chaincode as "deployer" with one admin, "admin"
+func newLedger(t *testing.T) *ledger {
+	l := &ledger{Session: sim.NewSession("hyperledger/part2", testChaincode{}, 1700000000), t: t}
+	l.as("deployer")
+	if res := l.Run("init", "init", []string{"1000", "admin"}); res.Err != nil {
+		t.Fatalf("init: %v", res.Err)
+	}
+	return l
+}
+
+// as signs the next transactions with this certificate
+func (l *ledger) as(cert string) {
+	l.Caller = []byte(cert)
+}
+
+// must runs an invoke that has to succeed
+func (l *ledger) must(function string, args ...string) {
+	l.t.Helper()
+	if res := l.Run("invoke", function, args); res.Err != nil {
+		l.t.Fatalf("%s %v: %v", function, args, res.Err)
+	}
+}
+
+// fails runs an invoke that has to fail with an error containing want
+func (l *ledger) fails(want string, function string, args ...string) {
+	l.t.Helper()
+	res := l.Run("invoke", function, args)
+	if res.Err == nil || !strings.Contains(res.Err.Error(), want) {
+		l.t.Fatalf("%s %v: got error %v, want %q", function, args, res.Err, want)
+	}
+}
+
+// query runs a query that has to succeed and unmarshals its payload into out
+func (l *ledger) query(out interface{}, function string, args ...string) {
+	l.t.Helper()
+	res := l.Run("query", function, args)
+	if res.Err != nil {
+		l.t.Fatalf("query %s %v: %v", function, args, res.Err)
+	}
+	if err := json.Unmarshal(res.Payload, out); err != nil {
+		l.t.Fatalf("query %s %v: %v", function, args, err)
+	}
+}
+
+// balance reads a user's tokens
+func (l *ledger) balance(user string) int {
+	l.t.Helper()
+	bal, err := getBalance(&sim.Stub{State: l.State}, user)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return bal
+}
+
+// game reads a game
+func (l *ledger) game(id string) Game {
+	l.t.Helper()
+	game, err := getGame(&sim.Stub{State: l.State}, id)
+	if err != nil {
+		l.t.Fatal(err)
+	}
+	return game
+}
+
+// participants registers each name under a certificate of the same name and funds it from the reserve
+func (l *ledger) participants(amount string, names ...string) {
+	l.t.Helper()
+	for _, name := range names {
+		l.as(name)
+		l.must("register_participant", name)
+		l.as("deployer")
+		l.must("fund_participant", "admin", name, amount)
+	}
+}
@@ -0,0 +1,432 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"strings"
+)
+
+var gamingPolicyStr = "_gamingpolicy"		//name for the key/value that will store the house betting limits
+var gamingPrefix = "_gaming_"				//prefix for the key/value that stores a participant's limits and totals
+
+type Limits struct{
+	MaxBet int `json:"max_bet"`				//largest single stake, 0 for no limit
+	MaxPerGame int `json:"max_per_game"`		//most staked on one game
+	MaxPerDay int `json:"max_per_day"`		//most staked per utc day
+}
+
+type GamingPolicy struct{
+	House Limits `json:"house"`				//applies to everyone
+	CoolingOff int64 `json:"cooling_off"`		//seconds before a participant's looser limits take effect
+}
+
+type GamingAccount struct{
+	User string `json:"user"`
+	Own Limits `json:"own"`					//limits the participant chose for themselves
+	Pending *Limits `json:"pending"`			//looser limits waiting out the cooling-off period
+	PendingAt int64 `json:"pending_at"`		//tx time in seconds the pending limits take effect
+	ExcludedUntil int64 `json:"excluded_until"`	//tx time in seconds, -1 for indefinitely
+	Day int64 `json:"day"`					//utc day the day total is for
+	DayTotal int `json:"day_total"`
+	GameTotals map[string]int `json:"game_totals"`	//staked so far per game
+}
+
+// ============================================================================================================================
+// Set Gaming Policy - admins set the house limits and the cooling-off period
+// ============================================================================================================================
+func (t *SimpleChaincode) set_gaming_policy(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2		3		4
+	//["admin", "100", "500", "1000", "86400"]   - max bet, max per game, max per day, cooling-off seconds
+	if len(args) != 5 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 5")
+	}
+
+	fmt.Println("- start set gaming policy")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	policy := GamingPolicy{}
+	policy.House, err = parseLimits(args[1:4])
+	if err != nil {
+		return nil, err
+	}
+	policy.CoolingOff, err = strconv.ParseInt(args[4], 10, 64)
+	if err != nil || policy.CoolingOff < 0 {
+		return nil, errors.New("5th argument must be a non-negative numeric string")
+	}
+	jsonAsBytes, _ := json.Marshal(policy)
+	err = stub.PutState(gamingPolicyStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set gaming policy")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set My Limits - a participant tightens their limits right away, loosening them waits out the cooling-off period
+// ============================================================================================================================
+func (t *SimpleChaincode) set_my_limits(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2		3
+	//["bob", "20", "50", "100"]   - max bet, max per game, max per day, 0 for no limit
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start set my limits")
+	if !isParticipant(stub, args[0]) {
+		return nil, errors.New("1st argument must be a registered participant")
+	}
+	err := checkCaller(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	limits, err := parseLimits(args[1:4])
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := getGamingPolicy(stub)
+	if err != nil {
+		return nil, err
+	}
+	account, err := getGamingAccount(stub, args[0], now)
+	if err != nil {
+		return nil, err
+	}
+
+	tighter := Limits{}														//the tightened ones apply now, the loosened ones keep the old value until they are due
+	tighter.MaxBet = tighten(limits.MaxBet, account.Own.MaxBet)
+	tighter.MaxPerGame = tighten(limits.MaxPerGame, account.Own.MaxPerGame)
+	tighter.MaxPerDay = tighten(limits.MaxPerDay, account.Own.MaxPerDay)
+	if tighter != limits {
+		fmt.Println("! looser limits wait " + strconv.FormatInt(policy.CoolingOff, 10) + " seconds")
+		account.Pending = &limits
+		account.PendingAt = now + policy.CoolingOff
+	} else {
+		account.Pending = nil
+	}
+	account.Own = tighter
+	err = putGamingAccount(stub, account)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set my limits")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Self Exclude - a participant stops themselves betting for a while, it can be extended but not shortened
+// ============================================================================================================================
+func (t *SimpleChaincode) self_exclude(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["bob", "2592000"]   - seconds, or "forever"
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start self exclude")
+	if !isParticipant(stub, args[0]) {
+		return nil, errors.New("1st argument must be a registered participant")
+	}
+	err := checkCaller(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseExclusion(args[1], now)
+	if err != nil {
+		return nil, err
+	}
+	account, err := getGamingAccount(stub, args[0], now)
+	if err != nil {
+		return nil, err
+	}
+	if account.ExcludedUntil == -1 || (until != -1 && until <= account.ExcludedUntil) {
+		return nil, errors.New("Self-exclusion can only be extended")
+	}
+	account.ExcludedUntil = until
+	err = putGamingAccount(stub, account)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end self exclude")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set Limits - admins set a participant's own limits, they apply right away with no cooling-off
+// ============================================================================================================================
+func (t *SimpleChaincode) set_limits(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2		3		4
+	//["admin", "bob", "20", "50", "100"]   - max bet, max per game, max per day, 0 for no limit
+	if len(args) != 5 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 5")
+	}
+
+	fmt.Println("- start set limits")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !isParticipant(stub, args[1]) {
+		return nil, errors.New("2nd argument must be a registered participant")
+	}
+	limits, err := parseLimits(args[2:5])
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	account, err := getGamingAccount(stub, args[1], now)
+	if err != nil {
+		return nil, err
+	}
+	account.Own = limits
+	account.Pending = nil													//anything the participant had waiting is replaced
+	account.PendingAt = 0
+	err = putGamingAccount(stub, account)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set limits")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set Exclusion - admins set or lift a participant's exclusion
+// ============================================================================================================================
+func (t *SimpleChaincode) set_exclusion(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2
+	//["admin", "bob", "0"]   - seconds from now, "forever", or 0 to lift
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start set exclusion")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	until, err := parseExclusion(args[2], now)
+	if err != nil {
+		return nil, err
+	}
+	account, err := getGamingAccount(stub, args[1], now)
+	if err != nil {
+		return nil, err
+	}
+	account.ExcludedUntil = until
+	err = putGamingAccount(stub, account)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set exclusion")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Gaming Account - read a participant's limits, exclusion and running totals
+// ============================================================================================================================
+func (t *SimpleChaincode) gaming_account(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting name of the participant to query")
+	}
+
+	accountAsBytes, err := stub.GetState(gamingPrefix + strings.ToLower(args[0]))	//queries have no tx time, so this is the stored record
+	if err != nil {
+		return nil, errors.New("Failed to get gaming account for " + args[0])
+	}
+	return accountAsBytes, nil
+}
+
+// ============================================================================================================================
+// checkLimits - called by init_bet, returns a coded error if the stake breaks a limit or the participant is excluded
+// ============================================================================================================================
+func checkLimits(stub stateStub, user string, game string, size int) error {
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	policy, err := getGamingPolicy(stub)
+	if err != nil {
+		return err
+	}
+	account, err := getGamingAccount(stub, user, now)
+	if err != nil {
+		return err
+	}
+
+	if size <= 0 {
+		return limitError("BAD_STAKE", "stake must be more than 0")
+	}
+	if account.ExcludedUntil == -1 || now < account.ExcludedUntil {
+		return limitError("SELF_EXCLUDED", user + " is excluded from betting")
+	}
+	if over(size, policy.House.MaxBet, account.Own.MaxBet) {
+		return limitError("MAX_BET", "stake is over the limit per bet")
+	}
+	if over(account.GameTotals[game] + size, policy.House.MaxPerGame, account.Own.MaxPerGame) {
+		return limitError("MAX_PER_GAME", "stake would go over the limit for this game")
+	}
+	if over(account.DayTotal + size, policy.House.MaxPerDay, account.Own.MaxPerDay) {
+		return limitError("MAX_PER_DAY", "stake would go over the limit for today")
+	}
+
+	account.DayTotal += size													//cancelled bets still count, like at the counter
+	account.GameTotals[game] += size
+	return putGamingAccount(stub, account)
+}
+
+// ============================================================================================================================
+// limitError - errors the client can tell apart, same json shape as read's errors plus a code
+// ============================================================================================================================
+func limitError(code string, msg string) error {
+	return errors.New("{\"Code\":\"" + code + "\",\"Error\":\"" + msg + "\"}")
+}
+
+// ============================================================================================================================
+// over - true if the amount breaks either limit, 0 means no limit
+// ============================================================================================================================
+func over(amount int, house int, own int) bool {
+	return (house > 0 && amount > house) || (own > 0 && amount > own)
+}
+
+// ============================================================================================================================
+// looser - true if the new limit allows more than the old one, 0 means no limit
+// ============================================================================================================================
+func looser(next int, prev int) bool {
+	if prev == 0 {
+		return false
+	}
+	return next == 0 || next > prev
+}
+
+// ============================================================================================================================
+// tighten - the limit to use now, the old one if the new one is looser
+// ============================================================================================================================
+func tighten(next int, prev int) int {
+	if looser(next, prev) {
+		return prev
+	}
+	return next
+}
+
+// ============================================================================================================================
+// parseLimits - max bet, max per game and max per day from numeric strings
+// ============================================================================================================================
+func parseLimits(args []string) (Limits, error) {
+	var vals []int
+	for _, arg := range args {
+		val, err := strconv.Atoi(arg)
+		if err != nil || val < 0 {
+			return Limits{}, errors.New("Limits must be non-negative numeric strings")
+		}
+		vals = append(vals, val)
+	}
+	return Limits{MaxBet: vals[0], MaxPerGame: vals[1], MaxPerDay: vals[2]}, nil
+}
+
+// ============================================================================================================================
+// parseExclusion - when an exclusion of this many seconds ends, -1 for "forever"
+// ============================================================================================================================
+func parseExclusion(arg string, now int64) (int64, error) {
+	if arg == "forever" {
+		return -1, nil
+	}
+	secs, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || secs < 0 {
+		return 0, errors.New("Exclusion must be a non-negative numeric string or forever")
+	}
+	if secs == 0 {
+		return 0, nil
+	}
+	return now + secs, nil
+}
+
+// ============================================================================================================================
+// getGamingPolicy - read the house limits
+// ============================================================================================================================
+func getGamingPolicy(stub stateStub) (GamingPolicy, error) {
+	policy := GamingPolicy{}
+	policyAsBytes, err := stub.GetState(gamingPolicyStr)
+	if err != nil {
+		return policy, errors.New("Failed to get gaming policy")
+	}
+	json.Unmarshal(policyAsBytes, &policy)										//un stringify it aka JSON.parse()
+	return policy, nil
+}
+
+// ============================================================================================================================
+// getGamingAccount - read a participant's limits and totals, applying pending limits and starting a new day as needed
+// ============================================================================================================================
+func getGamingAccount(stub stateStub, user string, now int64) (GamingAccount, error) {
+	user = strings.ToLower(user)
+	account := GamingAccount{}
+	accountAsBytes, err := stub.GetState(gamingPrefix + user)
+	if err != nil {
+		return account, errors.New("Failed to get gaming account for " + user)
+	}
+	json.Unmarshal(accountAsBytes, &account)									//un stringify it aka JSON.parse()
+	account.User = user
+	if account.GameTotals == nil {
+		account.GameTotals = map[string]int{}
+	}
+	if account.Pending != nil && now >= account.PendingAt {
+		account.Own = *account.Pending
+		account.Pending = nil
+	}
+	if day := now / 86400; day != account.Day {
+		account.Day = day
+		account.DayTotal = 0
+	}
+	return account, nil
+}
+
+// ============================================================================================================================
+// putGamingAccount - rewrite a participant's limits and totals
+// ============================================================================================================================
+func putGamingAccount(stub stateStub, account GamingAccount) error {
+	jsonAsBytes, _ := json.Marshal(account)
+	return stub.PutState(gamingPrefix + account.User, jsonAsBytes)
+}
@@ -0,0 +1,99 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/randyramnansingh/marbles-chaincode/sim"
+)
+
+func TestTighterLimitsApplyRightAway(t *testing.T) {
+	l := newLedger(t)
+	l.participants("100", "bob")
+	l.as("deployer")
+	l.must("set_gaming_policy", "admin", "0", "0", "0", "86400")
+	l.must("create_game", "admin", "g1", "red", "blue")
+
+	l.as("bob")
+	l.must("set_my_limits", "bob", "20", "50", "100")
+	l.must("set_my_limits", "bob", "10", "80", "100")
+	var account GamingAccount
+	l.query(&account, "gaming_account", "bob")
+	if account.Own != (Limits{MaxBet: 10, MaxPerGame: 50, MaxPerDay: 100}) {
+		t.Fatalf("own limits %+v, want the tighter max bet now and the old max per game", account.Own)
+	}
+	if account.Pending == nil || *account.Pending != (Limits{MaxBet: 10, MaxPerGame: 80, MaxPerDay: 100}) {
+		t.Fatalf("pending limits %+v, want the looser max per game queued", account.Pending)
+	}
+	l.fails("MAX_BET", "init_bet", "b1", "red", "15", "bob", "g1", "red")
+	l.must("init_bet", "b1", "red", "10", "bob", "g1", "red")
+}
+
+func TestStakeMustBePositive(t *testing.T) {
+	l := newLedger(t)
+	l.participants("100", "bob")
+	stub := &sim.Stub{State: l.State, Time: l.Time}
+	for _, size := range []int{0, -5} {
+		err := checkLimits(stub, "bob", "g1", size)
+		if err == nil || !strings.Contains(err.Error(), "BAD_STAKE") {
+			t.Fatalf("stake %d: got error %v, want BAD_STAKE", size, err)
+		}
+	}
+	if _, ok := l.State[gamingPrefix+"bob"]; ok {
+		t.Fatal("rejected stakes were added to bob's totals")
+	}
+}
+
+func TestOnlyTheParticipantSetsTheirOwnLimits(t *testing.T) {
+	l := newLedger(t)
+	l.participants("100", "bob", "eve")
+	l.as("deployer")
+	l.must("set_gaming_policy", "admin", "0", "0", "0", "86400")
+
+	l.as("eve")
+	l.fails("The caller is not bob", "set_my_limits", "bob", "1", "1", "1")
+	l.fails("The caller is not bob", "self_exclude", "bob", "forever")
+	l.fails("Only an admin", "set_limits", "eve", "bob", "1", "1", "1")
+	if _, ok := l.State[gamingPrefix+"bob"]; ok {
+		t.Fatal("eve changed bob's gaming account")
+	}
+}
+
+func TestAdminsSetLimitsWithoutCoolingOff(t *testing.T) {
+	l := newLedger(t)
+	l.participants("100", "bob")
+	l.as("deployer")
+	l.must("set_gaming_policy", "admin", "0", "0", "0", "86400")
+	l.must("create_game", "admin", "g1", "red", "blue")
+
+	l.as("bob")
+	l.must("set_my_limits", "bob", "10", "50", "100")
+	l.as("deployer")
+	l.must("set_limits", "admin", "bob", "30", "60", "100")
+	var account GamingAccount
+	l.query(&account, "gaming_account", "bob")
+	if account.Own != (Limits{MaxBet: 30, MaxPerGame: 60, MaxPerDay: 100}) || account.Pending != nil {
+		t.Fatalf("own limits %+v pending %+v, want the admin's limits right away", account.Own, account.Pending)
+	}
+	l.as("bob")
+	l.must("init_bet", "b1", "red", "25", "bob", "g1", "red")
+}
@@ -0,0 +1,369 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"strings"
+)
+
+var betsForSaleStr = "_betsforsale"			//name for the key/value that will store all bets listed for tokens
+
+type BetTransfer struct{
+	From string `json:"from"`
+	To string `json:"to"`
+	Price int `json:"price"`					//tokens paid, 0 for swaps and set_user
+	Via string `json:"via"`					//"set_user", "perform_trade" or "buy_bet"
+	TxID string `json:"tx_id"`
+}
+
+type BetListing struct{
+	Bet string `json:"bet"`
+	Seller string `json:"seller"`
+	Price int `json:"price"`					//tokens the buyer pays the seller
+	Value int `json:"value"`					//what the bet would have paid if its side won when it was listed
+}
+
+type BetSales struct{
+	Listings []BetListing `json:"listings"`
+}
+
+type BetValue struct{
+	Bet string `json:"bet"`
+	Stake int `json:"stake"`
+	Odds int `json:"odds"`					//decimal odds in hundredths the bet would be paid at now
+	Value int `json:"value"`					//what it would pay if its side won now
+	Tradeable bool `json:"tradeable"`
+}
+
+// ============================================================================================================================
+// Sell Bet - offer a bet you hold for tokens while its game is still open, relisting replaces the old price
+// ============================================================================================================================
+func (t *SimpleChaincode) sell_bet(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2
+	//["bob", "asdf", "40"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start sell bet")
+	price, err := strconv.Atoi(args[2])
+	if err != nil || price <= 0 {
+		return nil, errors.New("3rd argument must be a positive numeric string")
+	}
+	bet, err := getBet(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if strings.ToLower(bet.User) != strings.ToLower(args[0]) {
+		return nil, errors.New("Only the holder of a bet can sell it")
+	}
+	err = checkCaller(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	err = betTradeable(stub, bet)
+	if err != nil {
+		return nil, err
+	}
+	value, err := valueBet(stub, bet)
+	if err != nil {
+		return nil, err
+	}
+
+	sales, err := getBetSales(stub)
+	if err != nil {
+		return nil, err
+	}
+	if pos := findBetListing(sales, bet.Name); pos >= 0 {
+		sales.Listings = append(sales.Listings[:pos], sales.Listings[pos+1:]...)	//drop the old price
+	}
+	sales.Listings = append(sales.Listings, BetListing{Bet: bet.Name, Seller: strings.ToLower(args[0]), Price: price, Value: value.Value})
+	err = putBetSales(stub, sales)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end sell bet")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Unlist Bet - the seller takes a bet off the market
+// ============================================================================================================================
+func (t *SimpleChaincode) unlist_bet(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["bob", "asdf"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start unlist bet")
+	sales, err := getBetSales(stub)
+	if err != nil {
+		return nil, err
+	}
+	pos := findBetListing(sales, args[1])
+	if pos < 0 {
+		return nil, errors.New("Bet is not for sale")
+	}
+	if sales.Listings[pos].Seller != strings.ToLower(args[0]) {
+		return nil, errors.New("Only the seller can unlist a bet")
+	}
+	err = checkCaller(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	sales.Listings = append(sales.Listings[:pos], sales.Listings[pos+1:]...)
+	err = putBetSales(stub, sales)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end unlist bet")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Buy Bet - pay the seller's price from your balance and become the holder the bet settles to
+// ============================================================================================================================
+func (t *SimpleChaincode) buy_bet(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["alice", "asdf"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start buy bet")
+	buyer := strings.ToLower(args[0])
+	if !isParticipant(stub, buyer) {
+		return nil, errors.New("1st argument must be a registered participant")
+	}
+	err := checkCaller(stub, buyer)											//the price comes out of their balance
+	if err != nil {
+		return nil, err
+	}
+	sales, err := getBetSales(stub)
+	if err != nil {
+		return nil, err
+	}
+	pos := findBetListing(sales, args[1])
+	if pos < 0 {
+		return nil, errors.New("Bet is not for sale")
+	}
+	listing := sales.Listings[pos]
+	if listing.Seller == buyer {
+		return nil, errors.New("Cannot buy your own bet")
+	}
+
+	err = debit(stub, buyer, listing.Price)										//pay first, fails if the buyer is short
+	if err != nil {
+		return nil, err
+	}
+	err = credit(stub, listing.Seller, listing.Price)
+	if err != nil {
+		return nil, err
+	}
+	err = transferBet(stub, listing.Bet, buyer, listing.Price, "buy_bet")		//checks the seller still holds a tradeable bet
+	if err != nil {
+		return nil, err
+	}
+
+	sales.Listings = append(sales.Listings[:pos], sales.Listings[pos+1:]...)
+	err = putBetSales(stub, sales)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end buy bet")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Bets For Sale - list every bet that can be bought for tokens
+// ============================================================================================================================
+func (t *SimpleChaincode) bets_for_sale(stub stateStub, args []string) ([]byte, error) {
+	sales, err := getBetSales(stub)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(sales)
+}
+
+// ============================================================================================================================
+// Bet Value - reprice a bet at the game's current odds
+// ============================================================================================================================
+func (t *SimpleChaincode) bet_value(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting name of the bet to query")
+	}
+
+	bet, err := getBet(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	value, err := valueBet(stub, bet)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(value)
+}
+
+// ============================================================================================================================
+// transferBet - change the holder of a tradeable bet and record the transfer on the bet
+// ============================================================================================================================
+func transferBet(stub stateStub, name string, user string, price int, via string) error {
+	bet, err := getBet(stub, name)
+	if err != nil {
+		return err
+	}
+	err = betTradeable(stub, bet)
+	if err != nil {
+		return err
+	}
+	if via == "buy_bet" {
+		bet.Price = price
+	}
+	bet.Transfers = append(bet.Transfers, BetTransfer{From: bet.User, To: strings.ToLower(user), Price: price, Via: via, TxID: stub.GetTxID()})
+	bet.User = strings.ToLower(user)											//change the user
+
+	jsonAsBytes, _ := json.Marshal(bet)
+	return stub.PutState(name, jsonAsBytes)										//rewrite the bet with id as key
+}
+
+// ============================================================================================================================
+// betTradeable - bets can only change hands while they are live and their game is still taking bets
+// ============================================================================================================================
+func betTradeable(stub stateStub, bet Bet) error {
+	if bet.Status != "" {
+		return errors.New("Bet " + bet.Name + " has been " + bet.Status)
+	}
+	game, err := getGame(stub, bet.Game)
+	if err != nil {
+		return err
+	}
+	if game.Status != "open" {
+		return errors.New("Bet " + bet.Name + " is on a game that is " + game.Status)
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// valueBet - what a bet would pay if its side won at the game's current odds
+// ============================================================================================================================
+func valueBet(stub stateStub, bet Bet) (BetValue, error) {
+	value := BetValue{Bet: bet.Name, Stake: bet.Size}
+	game, err := getGame(stub, bet.Game)
+	if err != nil {
+		return value, err
+	}
+	if game.Mode == "fixed" {
+		value.Odds = bet.Odds
+	} else if game.Pools[bet.Side] > 0 {
+		value.Odds = netPot(game) * 100 / game.Pools[bet.Side]
+	}
+	value.Value = bet.Size * value.Odds / 100
+	value.Tradeable = betTradeable(stub, bet) == nil
+	return value, nil
+}
+
+// ============================================================================================================================
+// Clean Up Bet Sales - remove listings the seller no longer holds or that can no longer be traded
+// ============================================================================================================================
+func cleanBetSales(stub stateStub)(err error){
+	var didWork = false
+	fmt.Println("- start clean bet sales")
+
+	sales, err := getBetSales(stub)
+	if err != nil {
+		return err
+	}
+	for i := 0; i < len(sales.Listings); i++ {
+		bet, e := getBet(stub, sales.Listings[i].Bet)
+		if e != nil || strings.ToLower(bet.User) != sales.Listings[i].Seller || betTradeable(stub, bet) != nil {
+			fmt.Println("! " + sales.Listings[i].Bet + " can no longer be sold, removing listing")
+			didWork = true
+			sales.Listings = append(sales.Listings[:i], sales.Listings[i+1:]...)
+			i--
+		}
+	}
+
+	if didWork {
+		err = putBetSales(stub, sales)
+		if err != nil {
+			return err
+		}
+	}
+	fmt.Println("- end clean bet sales")
+	return nil
+}
+
+// ============================================================================================================================
+// findBetListing - position of the listing for this bet, -1 if it is not for sale
+// ============================================================================================================================
+func findBetListing(sales BetSales, name string) int {
+	for i := range sales.Listings {
+		if sales.Listings[i].Bet == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// ============================================================================================================================
+// getBetSales - read the bets for sale
+// ============================================================================================================================
+func getBetSales(stub stateStub) (BetSales, error) {
+	var sales BetSales
+	salesAsBytes, err := stub.GetState(betsForSaleStr)
+	if err != nil {
+		return sales, errors.New("Failed to get bets for sale")
+	}
+	json.Unmarshal(salesAsBytes, &sales)										//un stringify it aka JSON.parse()
+	return sales, nil
+}
+
+// ============================================================================================================================
+// putBetSales - rewrite the bets for sale
+// ============================================================================================================================
+func putBetSales(stub stateStub, sales BetSales) error {
+	jsonAsBytes, _ := json.Marshal(sales)
+	return stub.PutState(betsForSaleStr, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// getBet - read a bet by name
+// ============================================================================================================================
+func getBet(stub stateStub, name string) (Bet, error) {
+	bet := Bet{}
+	betAsBytes, err := stub.GetState(name)
+	if err != nil {
+		return bet, errors.New("Failed to get bet")
+	}
+	json.Unmarshal(betAsBytes, &bet)											//un stringify it aka JSON.parse()
+	if bet.Name != name {
+		return bet, errors.New("Did not find bet " + name)
+	}
+	return bet, nil
+}
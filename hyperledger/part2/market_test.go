@@ -0,0 +1,114 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+// market opens g1 with bob holding b1 on red and alice holding b2 on blue, eve holds nothing
+func market(t *testing.T) *ledger {
+	l := newLedger(t)
+	l.participants("100", "bob", "alice", "eve")
+	l.as("deployer")
+	l.must("create_game", "admin", "g1", "red", "blue")
+	l.as("bob")
+	l.must("init_bet", "b1", "red", "40", "bob", "g1", "red")
+	l.as("alice")
+	l.must("init_bet", "b2", "blue", "40", "alice", "g1", "blue")
+	return l
+}
+
+// holder reads who holds a bet
+func (l *ledger) holder(name string) string {
+	l.t.Helper()
+	var bet Bet
+	if err := json.Unmarshal(l.State[name], &bet); err != nil {
+		l.t.Fatal(err)
+	}
+	return bet.User
+}
+
+func TestOnlyTheHolderSellsOrUnlists(t *testing.T) {
+	l := market(t)
+	l.as("eve")
+	l.fails("The caller is not bob", "sell_bet", "bob", "b1", "10")
+	l.as("bob")
+	l.must("sell_bet", "bob", "b1", "10")
+	l.as("eve")
+	l.fails("The caller is not bob", "unlist_bet", "bob", "b1")
+	var sales BetSales
+	l.query(&sales, "bets_for_sale")
+	if len(sales.Listings) != 1 || sales.Listings[0].Price != 10 {
+		t.Fatalf("listings %+v, want bob's at 10", sales.Listings)
+	}
+}
+
+func TestOnlyTheBuyerPaysForABet(t *testing.T) {
+	l := market(t)
+	l.as("bob")
+	l.must("sell_bet", "bob", "b1", "10")
+	l.as("eve")
+	l.fails("The caller is not alice", "buy_bet", "alice", "b1")
+	if bal := l.balance("alice"); bal != 60 {
+		t.Fatalf("alice holds %d, want 60", bal)
+	}
+	if user := l.holder("b1"); user != "bob" {
+		t.Fatalf("b1 is held by %s, want bob", user)
+	}
+}
+
+func TestOnlyTheHolderSetsTheUser(t *testing.T) {
+	l := market(t)
+	l.as("eve")
+	l.fails("The caller is not bob", "set_user", "b1", "eve")
+	l.as("bob")
+	l.must("set_user", "b1", "eve")
+	if user := l.holder("b1"); user != "eve" {
+		t.Fatalf("b1 is held by %s, want eve", user)
+	}
+}
+
+func TestOnlyTheHoldersTrade(t *testing.T) {
+	l := market(t)
+	l.as("eve")
+	l.fails("The caller is not bob", "open_trade", "bob", "blue", "40", "red", "40")
+	l.as("bob")
+	l.must("open_trade", "bob", "blue", "40", "red", "40")
+	var trades AllTrades
+	if err := json.Unmarshal(l.State[openTradesStr], &trades); err != nil || len(trades.OpenTrades) != 1 {
+		t.Fatalf("open trades %+v, %v, want bob's", trades.OpenTrades, err)
+	}
+	id := strconv.FormatInt(trades.OpenTrades[0].Timestamp, 10)
+
+	l.as("eve")
+	l.fails("The caller is not alice", "perform_trade", id, "alice", "b2", "bob", "red", "40")
+	l.fails("eve does not own b2", "perform_trade", id, "eve", "b2", "bob", "red", "40")
+	if l.holder("b1") != "bob" || l.holder("b2") != "alice" {
+		t.Fatalf("b1 held by %s and b2 by %s, want no change", l.holder("b1"), l.holder("b2"))
+	}
+	l.as("alice")
+	l.must("perform_trade", id, "alice", "b2", "bob", "red", "40")
+	if l.holder("b1") != "alice" || l.holder("b2") != "bob" {
+		t.Fatalf("b1 held by %s and b2 by %s, want them swapped", l.holder("b1"), l.holder("b2"))
+	}
+}
@@ -0,0 +1,192 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+)
+
+var houseStr = "_house"						//balance that keeps the house cut, and covers fixed odds payouts
+
+type GameOdds struct{
+	Game string `json:"game"`
+	Mode string `json:"mode"`
+	Pot int `json:"pot"`
+	HouseCut int `json:"house_cut"`
+	Pools map[string]int `json:"pools"`		//total wagered on each side
+	Odds map[string]int `json:"odds"`			//decimal odds per side in hundredths, 0 if nothing would be paid
+}
+
+// ============================================================================================================================
+// Set Game Terms - admins choose how an open game with no bets yet pays out
+// ============================================================================================================================
+func (t *SimpleChaincode) set_game_terms(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2				3
+	//["admin", "game", "parimutuel", "5"]   - house cut percent, ignored for fixed odds
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start set game terms")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	game, err := getGame(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "open" || len(game.Bets) > 0 {
+		return nil, errors.New("Terms can only change on an open game with no bets")
+	}
+	if args[2] != "parimutuel" && args[2] != "fixed" {
+		return nil, errors.New("3rd argument must be parimutuel or fixed")
+	}
+	cut, err := strconv.Atoi(args[3])
+	if err != nil || cut < 0 || cut > 100 {
+		return nil, errors.New("4th argument must be a numeric string from 0 to 100")
+	}
+	game.Mode = args[2]
+	game.HouseCut = cut
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set game terms")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set Fixed Odds - admins offer odds on a side of a fixed odds game, bets already placed keep the odds they got
+// ============================================================================================================================
+func (t *SimpleChaincode) set_fixed_odds(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2		3
+	//["admin", "game", "red", "250"]   - decimal odds in hundredths, 250 pays 2.50 per 1 staked
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start set fixed odds")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	game, err := getGame(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "open" || game.Mode != "fixed" {
+		return nil, errors.New("Odds can only be offered on an open fixed odds game")
+	}
+	if !hasSide(game, args[2]) {
+		return nil, errors.New("3rd argument must be one of the game's sides")
+	}
+	odds, err := strconv.Atoi(args[3])
+	if err != nil || odds < 100 {
+		return nil, errors.New("4th argument must be a numeric string of at least 100")
+	}
+	if game.FixedOdds == nil {
+		game.FixedOdds = map[string]int{}
+	}
+	game.FixedOdds[args[2]] = odds
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set fixed odds")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Game Odds - the pool on each side and what a bet placed now would be paid per 1 staked
+// ============================================================================================================================
+func (t *SimpleChaincode) game_odds(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	game, err := getGame(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	res := GameOdds{Game: game.ID, Mode: game.Mode, Pot: game.Pot, HouseCut: game.HouseCut, Pools: map[string]int{}, Odds: map[string]int{}}
+	for _, side := range game.Sides {
+		res.Pools[side] = game.Pools[side]
+		if game.Mode == "fixed" {
+			res.Odds[side] = game.FixedOdds[side]
+		} else if game.Pools[side] > 0 {
+			res.Odds[side] = netPot(game) * 100 / game.Pools[side]				//implied odds if the game ended now
+		}
+	}
+	return json.Marshal(res)
+}
+
+// ============================================================================================================================
+// settleBet - what a bet is paid once its game is resolved
+// ============================================================================================================================
+func settleBet(game Game, bet Bet) int {
+	if game.Mode != "fixed" && game.Pools[game.Winner] == 0 {					//nobody backed the winner, everyone gets their stake back
+		return bet.Size
+	}
+	if bet.Side != game.Winner {
+		return 0
+	}
+	if game.Mode == "fixed" {
+		return bet.Size * bet.Odds / 100
+	}
+	return netPot(game) * bet.Size / game.Pools[game.Winner]					//share of the pot after the house cut
+}
+
+// ============================================================================================================================
+// checkExposure - error if the house could not pay out this fixed odds game whichever side wins. Other games are not
+// counted, payoutGame still refuses to take the house below 0 if several lose at once
+// ============================================================================================================================
+func checkExposure(stub stateStub, game Game) error {
+	worst := 0
+	for _, owed := range game.Liability {
+		if owed - game.Pot > worst {
+			worst = owed - game.Pot
+		}
+	}
+	if worst == 0 {
+		return nil
+	}
+	house, err := getBalance(stub, houseStr)
+	if err != nil {
+		return err
+	}
+	if house < worst {
+		return errors.New("The house holds " + strconv.Itoa(house) + " and cannot cover a loss of " + strconv.Itoa(worst) + " on these odds")
+	}
+	return nil
+}
+
+// ============================================================================================================================
+// netPot - the pari-mutuel pot left for the winners once the house takes its cut
+// ============================================================================================================================
+func netPot(game Game) int {
+	return game.Pot - game.Pot * game.HouseCut / 100
+}
@@ -0,0 +1,328 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"strings"
+
+	"github.com/randyramnansingh/marbles-chaincode/oracle"
+)
+
+var adminsStr = "_admins"					//name for the key/value that will store the users allowed to change settings
+var oraclePolicyStr = "_oraclepolicy"		//name for the key/value that will store the trusted oracles and threshold
+
+type OraclePolicy struct{
+	Oracles map[string]string `json:"oracles"`	//oracle name -> hex of its PKIX DER encoded ECDSA public key
+	Threshold int `json:"threshold"`			//how many oracles must sign the same side
+	DisputeWindow int64 `json:"dispute_window"`	//seconds a reported result can be disputed before payout
+}
+
+type Dispute struct{
+	By string `json:"by"`						//participant who raised it
+	Reason string `json:"reason"`
+	Timestamp int64 `json:"timestamp"`			//tx time in seconds
+	Outcome string `json:"outcome"`			//"", "upheld" or "overturned"
+}
+
+// ============================================================================================================================
+// Register Oracle - admins trust a public key to sign game results, registering a name again replaces its key
+// ============================================================================================================================
+func (t *SimpleChaincode) register_oracle(stub stateStub, args []string) ([]byte, error) {
+	//	0		1			2
+	//["admin", "scores", "3059301306..."]   - hex of a PKIX DER encoded ECDSA public key
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start register oracle")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if _, err = oracle.ParsePublicKey(args[2]); err != nil {
+		return nil, err
+	}
+	policy, err := getOraclePolicy(stub)
+	if err != nil {
+		return nil, err
+	}
+	policy.Oracles[strings.ToLower(args[1])] = strings.ToLower(args[2])
+	err = putOraclePolicy(stub, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end register oracle")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Set Oracle Policy - admins choose M of the N registered oracles and the dispute window
+// ============================================================================================================================
+func (t *SimpleChaincode) set_oracle_policy(stub stateStub, args []string) ([]byte, error) {
+	//	0		1	2
+	//["admin", "2", "3600"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start set oracle policy")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	policy, err := getOraclePolicy(stub)
+	if err != nil {
+		return nil, err
+	}
+	policy.Threshold, err = strconv.Atoi(args[1])
+	if err != nil || policy.Threshold < 1 {
+		return nil, errors.New("2nd argument must be a positive numeric string")
+	}
+	policy.DisputeWindow, err = strconv.ParseInt(args[2], 10, 64)
+	if err != nil || policy.DisputeWindow < 0 {
+		return nil, errors.New("3rd argument must be a non-negative numeric string")
+	}
+	err = putOraclePolicy(stub, policy)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end set oracle policy")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Submit Result - a registered oracle's signed result for a locked game, the game is reported once enough oracles agree
+// ============================================================================================================================
+func (t *SimpleChaincode) submit_result(stub stateStub, args []string) ([]byte, error) {
+	//	0		1			2		3
+	//["game", "scores", "red", "3045022100..."]   - hex of an ASN.1 ECDSA signature, see oracle.Sign
+	//the signature covers the game's report round, so results signed before an overturn are no longer accepted
+	if len(args) != 4 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	}
+
+	fmt.Println("- start submit result")
+	name := strings.ToLower(args[1])
+	game, err := getGame(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "locked" && game.Status != "reported" {
+		return nil, errors.New("Results can only be submitted for a locked game, it is " + game.Status)
+	}
+	if !hasSide(game, args[2]) {
+		return nil, errors.New("3rd argument must be one of the game's sides")
+	}
+	policy, err := getOraclePolicy(stub)
+	if err != nil {
+		return nil, err
+	}
+	keyHex, ok := policy.Oracles[name]
+	if !ok {
+		return nil, errors.New("Not a registered oracle: " + name)
+	}
+	err = oracle.Verify(keyHex, game.ID, game.Round, args[2], args[3])
+	if err != nil {
+		return nil, err
+	}
+
+	if game.Reports == nil {
+		game.Reports = map[string]string{}
+	}
+	game.Reports[name] = args[2]
+	if game.Status == "locked" {
+		agree := 0
+		for name, side := range game.Reports {
+			if _, ok := policy.Oracles[name]; ok && side == args[2] {		//only count oracles that are still trusted
+				agree++
+			}
+		}
+		if agree >= policy.Threshold {
+			now, err := txTimestamp(stub)
+			if err != nil {
+				return nil, err
+			}
+			fmt.Println("! " + strconv.Itoa(agree) + " oracles agree on " + args[2])
+			game.Status = "reported"
+			game.Reported = args[2]
+			game.DisputeEnd = now + policy.DisputeWindow
+		}
+	}
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end submit result")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Dispute Result - a participant challenges a reported result inside the dispute window, holding up payout
+// ============================================================================================================================
+func (t *SimpleChaincode) dispute_result(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2
+	//["game", "bob", "replay shows blue won"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start dispute result")
+	if !isParticipant(stub, args[1]) {
+		return nil, errors.New("2nd argument must be a registered participant")
+	}
+	err := checkCaller(stub, args[1])											//a dispute holds up payout, nobody may raise one in another's name
+	if err != nil {
+		return nil, err
+	}
+	game, err := getGame(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "reported" || now >= game.DisputeEnd {
+		return nil, errors.New("Game has no result that can still be disputed")
+	}
+	game.Status = "disputed"
+	game.Disputes = append(game.Disputes, Dispute{By: strings.ToLower(args[1]), Reason: args[2], Timestamp: now})
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end dispute result")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Settle Dispute - admins uphold the reported result so it can be paid out, or overturn it so the oracles report again
+// ============================================================================================================================
+func (t *SimpleChaincode) settle_dispute(stub stateStub, args []string) ([]byte, error) {
+	//	0		1		2
+	//["admin", "game", "uphold"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3")
+	}
+
+	fmt.Println("- start settle dispute")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	game, err := getGame(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "disputed" {
+		return nil, errors.New("Game is not disputed")
+	}
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return nil, err
+	}
+	last := &game.Disputes[len(game.Disputes) - 1]
+	switch args[2] {
+	case "uphold":
+		last.Outcome = "upheld"
+		game.Status = "reported"
+		game.DisputeEnd = now													//ready for resolve_game
+	case "overturn":
+		last.Outcome = "overturned"
+		game.Status = "locked"
+		game.Reported = ""
+		game.Reports = map[string]string{}
+		game.Round++															//the overturned signatures are for the old round
+	default:
+		return nil, errors.New("3rd argument must be uphold or overturn")
+	}
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end settle dispute")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// getOraclePolicy - read the trusted oracles and threshold
+// ============================================================================================================================
+func getOraclePolicy(stub stateStub) (OraclePolicy, error) {
+	policy := OraclePolicy{}
+	policyAsBytes, err := stub.GetState(oraclePolicyStr)
+	if err != nil {
+		return policy, errors.New("Failed to get oracle policy")
+	}
+	json.Unmarshal(policyAsBytes, &policy)										//un stringify it aka JSON.parse()
+	if policy.Oracles == nil {
+		policy.Oracles = map[string]string{}
+	}
+	if policy.Threshold < 1 {
+		policy.Threshold = 1
+	}
+	return policy, nil
+}
+
+// ============================================================================================================================
+// putOraclePolicy - rewrite the trusted oracles and threshold
+// ============================================================================================================================
+func putOraclePolicy(stub stateStub, policy OraclePolicy) error {
+	jsonAsBytes, _ := json.Marshal(policy)
+	return stub.PutState(oraclePolicyStr, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// requireAdmin - error unless this user was named an admin when the chaincode was initialized and the caller may act as them
+// ============================================================================================================================
+func requireAdmin(stub stateStub, user string) error {
+	adminsAsBytes, err := stub.GetState(adminsStr)
+	if err != nil {
+		return errors.New("Failed to get admins")
+	}
+	var admins []string
+	json.Unmarshal(adminsAsBytes, &admins)										//un stringify it aka JSON.parse()
+	for _, admin := range admins {
+		if admin == strings.ToLower(user) {
+			return checkCaller(stub, user)
+		}
+	}
+	return errors.New("Only an admin can do that: " + user)
+}
+
+// ============================================================================================================================
+// txTimestamp - seconds since epoch of the transaction, the same on every peer
+// ============================================================================================================================
+func txTimestamp(stub stateStub) (int64, error) {
+	ts, err := stub.GetTxTimestamp()
+	if err != nil || ts == nil {
+		return 0, errors.New("Failed to get transaction timestamp")
+	}
+	return ts.Seconds, nil
+}
@@ -0,0 +1,101 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"crypto/ecdsa"
+	"testing"
+
+	"github.com/randyramnansingh/marbles-chaincode/oracle"
+)
+
+func sign(t *testing.T, key *ecdsa.PrivateKey, game string, round int, side string) string {
+	t.Helper()
+	sig, err := oracle.Sign(key, game, round, side)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sig
+}
+
+// reportedGame sets up g1 with a bet on each side, locked and waiting for the "scores" oracle
+func reportedGame(t *testing.T) (*ledger, *ecdsa.PrivateKey) {
+	l := newLedger(t)
+	l.participants("100", "bob", "alice")
+	l.as("deployer")
+	l.must("create_game", "admin", "g1", "red", "blue")
+	l.as("bob")
+	l.must("init_bet", "b1", "red", "10", "bob", "g1", "red")
+	l.as("alice")
+	l.must("init_bet", "b2", "red", "10", "alice", "g1", "blue")
+
+	key, err := oracle.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := oracle.PublicKeyHex(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.as("deployer")
+	l.must("lock_game", "admin", "g1")
+	l.must("register_oracle", "admin", "scores", pub)
+	l.must("set_oracle_policy", "admin", "1", "3600")
+	return l, key
+}
+
+func TestSubmitResultChecksSignature(t *testing.T) {
+	l, key := reportedGame(t)
+	l.fails("Signature does not match", "submit_result", "g1", "scores", "blue", sign(t, key, "g1", 0, "red"))
+	l.fails("Signature does not match", "submit_result", "g1", "scores", "red", sign(t, key, "g1", 1, "red"))
+	l.must("submit_result", "g1", "scores", "red", sign(t, key, "g1", 0, "red"))
+	if game := l.game("g1"); game.Status != "reported" || game.Reported != "red" {
+		t.Fatalf("game is %s with %q reported, want reported red", game.Status, game.Reported)
+	}
+}
+
+func TestOverturnedSignaturesCannotBeReplayed(t *testing.T) {
+	l, key := reportedGame(t)
+	old := sign(t, key, "g1", 0, "red")
+	l.must("submit_result", "g1", "scores", "red", old)
+	l.as("alice")
+	l.must("dispute_result", "g1", "alice", "blue won")
+	l.as("deployer")
+	l.must("settle_dispute", "admin", "g1", "overturn")
+
+	if game := l.game("g1"); game.Status != "locked" || game.Round != 1 {
+		t.Fatalf("game is %s in round %d, want locked in round 1", game.Status, game.Round)
+	}
+	l.fails("Signature does not match", "submit_result", "g1", "scores", "red", old)
+	l.must("submit_result", "g1", "scores", "blue", sign(t, key, "g1", 1, "blue"))
+	if game := l.game("g1"); game.Reported != "blue" {
+		t.Fatalf("reported %q, want blue", game.Reported)
+	}
+}
+
+func TestOnlyTheParticipantDisputes(t *testing.T) {
+	l, key := reportedGame(t)
+	l.must("submit_result", "g1", "scores", "red", sign(t, key, "g1", 0, "red"))
+	l.as("eve")
+	l.fails("The caller is not alice", "dispute_result", "g1", "alice", "blue won")
+	if game := l.game("g1"); game.Status != "reported" {
+		t.Fatalf("game is %s after eve's dispute, want reported", game.Status)
+	}
+}
@@ -28,6 +28,7 @@ import (
 	"strings"
 
 	"github.com/hyperledger/fabric/core/chaincode/shim"
+	"github.com/randyramnansingh/marbles-chaincode/txlog"
 )
 
 // SimpleChaincode example simple Chaincode implementation
@@ -42,6 +43,14 @@ type Bet struct{
 	Color string `json:"color"`
 	Size int `json:"size"`
 	User string `json:"user"`
+	Stake int `json:"stake"`					//tokens taken from the bettor when the bet was placed, all a refund gives back
+	Game string `json:"game"`					//id of the game this bet is on
+	Side string `json:"side"`					//side of the game the bet backs
+	Payout int `json:"payout"`				//tokens paid to the holder when the game was resolved
+	Odds int `json:"odds"`					//fixed odds games - the odds in hundredths when the bet was placed
+	Status string `json:"status"`				//"" while live, "cancelled" or "refunded" once the stake was paid back
+	Price int `json:"price"`					//tokens paid the last time it was bought, 0 if it was never sold
+	Transfers []BetTransfer `json:"transfers"`	//every change of holder, settlement pays whoever holds it last
 }
 
 type Description struct{
@@ -61,24 +70,25 @@ type AllTrades struct{
 }
 
 // ============================================================================================================================
-// Main
+// Init - reset all the things
 // ============================================================================================================================
-func main() {
-	err := shim.Start(new(SimpleChaincode))
-	if err != nil {
-		fmt.Printf("Error starting Simple chaincode: %s", err)
-	}
+func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	res, err := t.reset(stub, args)
+	txlog.Record(stub, "init", function, args, res, err)						//no-op unless MARBLES_TXLOG is set
+	return res, err
 }
 
 // ============================================================================================================================
-// Init - reset all the things
+// reset - write the starting state, also used by the "init" invoke
 // ============================================================================================================================
-func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+func (t *SimpleChaincode) reset(stub stateStub, args []string) ([]byte, error) {
 	var Aval int
 	var err error
 
-	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	//   0       1...
+	// "100", "admin"...   - optional admins may follow the asset holding
+	if len(args) < 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting at least 1")
 	}
 
 	// Initialize the chaincode
@@ -107,6 +117,56 @@ func (t *SimpleChaincode) Init(stub *shim.ChaincodeStub, function string, args [
 		return nil, err
 	}
 	
+	jsonAsBytes, _ = json.Marshal(empty)								//clear the game index
+	err = stub.PutState(gameIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(BetSales{})							//clear the bets for sale
+	err = stub.PutState(betsForSaleStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal([]LeaderEntry{})						//clear the leaderboard
+	err = stub.PutState(leaderboardStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(empty)								//clear the refund index
+	err = stub.PutState(refundIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(empty)								//clear the participant index
+	err = stub.PutState(participantIndexStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
+	var admins []string
+	for _, admin := range args[1:] {
+		admins = append(admins, strings.ToLower(admin))
+	}
+	jsonAsBytes, _ = json.Marshal(admins)								//store who may register oracles and settle disputes
+	err = stub.PutState(adminsStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	err = bindAdmins(stub, admins)										//only the deployer's certificate may act as them
+	if err != nil {
+		return nil, err
+	}
+	
+	jsonAsBytes, _ = json.Marshal(OraclePolicy{Oracles: map[string]string{}, Threshold: 1})	//no oracles until an admin registers them
+	err = stub.PutState(oraclePolicyStr, jsonAsBytes)
+	if err != nil {
+		return nil, err
+	}
+	
 	return nil, nil
 }
 
@@ -122,31 +182,121 @@ func (t *SimpleChaincode) Run(stub *shim.ChaincodeStub, function string, args []
 // Invoke - Our entry point for Invocations
 // ============================================================================================================================
 func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	res, err := t.invokeTx(stub, function, args)
+	txlog.Record(stub, "invoke", function, args, res, err)
+	return res, err
+}
+
+// ============================================================================================================================
+// invokeTx - run one invocation as a transaction, also used by the simulator
+// ============================================================================================================================
+func (t *SimpleChaincode) invokeTx(stub stateStub, function string, args []string) ([]byte, error) {
+	cache := newTxCache(stub)												//reads hit the peer once, writes go out once per key
+	res, err := t.invoke(cache, function, args)
+	if err != nil {
+		return nil, err
+	}
+	err = cache.flush()
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ============================================================================================================================
+// invoke - run one invocation against the transaction cache
+// ============================================================================================================================
+func (t *SimpleChaincode) invoke(stub stateStub, function string, args []string) ([]byte, error) {
 	fmt.Println("invoke is running " + function)
 
 	// Handle different functions
 	if function == "init" {													//initialize the chaincode state, used as reset
-		return t.Init(stub, "init", args)
-	} else if function == "delete" {										//deletes an entity from its state
+		err := requireAdminCaller(stub)
+		if err != nil {
+			return nil, err
+		}
+		return t.reset(stub, args)
+	} else if function == "delete" {										//admins delete an entity from its state
 		res, err := t.Delete(stub, args)
 		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanBetSales(stub)												//drop listings the seller no longer holds or can sell
 		return res, err
-	} else if function == "write" {											//writes a value to the chaincode state
+	} else if function == "write" {											//admins write a value to the chaincode state
 		return t.Write(stub, args)
 	} else if function == "init_bet" {									//create a new bet
 		return t.init_bet(stub, args)
 	} else if function == "set_user" {										//change owner of a bet
 		res, err := t.set_user(stub, args)
 		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanBetSales(stub)												//drop listings the seller no longer holds or can sell
 		return res, err
 	} else if function == "open_trade" {									//create a new trade order
 		return t.open_trade(stub, args)
 	} else if function == "perform_trade" {									//forfill an open trade order
 		res, err := t.perform_trade(stub, args)
 		cleanTrades(stub)													//lets clean just in case
+		cleanBetSales(stub)												//drop listings the seller no longer holds or can sell
 		return res, err
 	} else if function == "remove_trade" {									//cancel an open trade order
 		return t.remove_trade(stub, args)
+	} else if function == "register_participant" {							//add a named participant who can hold bets
+		return t.register_participant(stub, args)
+	} else if function == "fund_participant" {								//give a participant tokens to bet with
+		return t.fund_participant(stub, args)
+	} else if function == "create_game" {									//open a new game for bets
+		return t.create_game(stub, args)
+	} else if function == "lock_game" {										//stop taking bets on a game
+		res, err := t.lock_game(stub, args)
+		cleanTrades(stub)													//bets on this game can no longer be traded
+		cleanBetSales(stub)												//drop listings the seller no longer holds or can sell
+		return res, err
+	} else if function == "set_game_terms" {								//choose pari-mutuel or fixed odds and the house cut
+		return t.set_game_terms(stub, args)
+	} else if function == "set_fixed_odds" {								//offer fixed odds on a side
+		return t.set_fixed_odds(stub, args)
+	} else if function == "register_oracle" {								//trust a public key to sign game results
+		return t.register_oracle(stub, args)
+	} else if function == "set_oracle_policy" {								//how many oracles must agree and how long results can be disputed
+		return t.set_oracle_policy(stub, args)
+	} else if function == "submit_result" {									//an oracle's signed result for a game
+		return t.submit_result(stub, args)
+	} else if function == "dispute_result" {								//challenge a reported result before payout
+		return t.dispute_result(stub, args)
+	} else if function == "settle_dispute" {								//admins uphold or overturn a disputed result
+		return t.settle_dispute(stub, args)
+	} else if function == "cancel_bet" {									//withdraw a bet before its game locks
+		res, err := t.cancel_bet(stub, args)
+		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanBetSales(stub)												//drop listings the seller no longer holds or can sell
+		return res, err
+	} else if function == "void_game" {										//call off a game and refund every stake
+		res, err := t.void_game(stub, args)
+		cleanTrades(stub)													//bets on this game can no longer be traded
+		cleanBetSales(stub)												//drop listings the seller no longer holds or can sell
+		return res, err
+	} else if function == "sell_bet" {										//offer a bet for tokens
+		return t.sell_bet(stub, args)
+	} else if function == "unlist_bet" {									//take a bet off the market
+		return t.unlist_bet(stub, args)
+	} else if function == "buy_bet" {										//pay for a listed bet
+		res, err := t.buy_bet(stub, args)
+		cleanTrades(stub)													//lets make sure all open trades are still valid
+		cleanBetSales(stub)												//drop listings the seller no longer holds or can sell
+		return res, err
+	} else if function == "set_gaming_policy" {								//house betting limits and cooling-off period
+		return t.set_gaming_policy(stub, args)
+	} else if function == "set_my_limits" {									//a participant's own betting limits
+		return t.set_my_limits(stub, args)
+	} else if function == "set_limits" {										//admins set a participant's betting limits
+		return t.set_limits(stub, args)
+	} else if function == "self_exclude" {									//a participant stops themselves betting
+		return t.self_exclude(stub, args)
+	} else if function == "set_exclusion" {									//admins set or lift an exclusion
+		return t.set_exclusion(stub, args)
+	} else if function == "resolve_game" {									//record the winning side and pay out
+		return t.resolve_game(stub, args)
+	} else if function == "cancel_game" {									//call off a game nobody has bet on
+		return t.cancel_game(stub, args)
 	}
 	fmt.Println("invoke did not find func: " + function)					//error
 
@@ -157,11 +307,40 @@ func (t *SimpleChaincode) Invoke(stub *shim.ChaincodeStub, function string, args
 // Query - Our entry point for Queries
 // ============================================================================================================================
 func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args []string) ([]byte, error) {
+	res, err := t.query(newTxCache(stub), function, args)						//queries never flush, the cache only saves reads
+	txlog.Record(stub, "query", function, args, res, err)
+	return res, err
+}
+
+// ============================================================================================================================
+// query - run one query against the stub
+// ============================================================================================================================
+func (t *SimpleChaincode) query(stub stateStub, function string, args []string) ([]byte, error) {
 	fmt.Println("query is running " + function)
 
 	// Handle different functions
 	if function == "read" {													//read a variable
 		return t.read(stub, args)
+	} else if function == "read_game" {										//read a game
+		return t.read_game(stub, args)
+	} else if function == "game_odds" {										//read the pools and current odds of a game
+		return t.game_odds(stub, args)
+	} else if function == "refunds" {										//read the refund audit trail
+		return t.refunds(stub, args)
+	} else if function == "gaming_account" {								//read a participant's limits and totals
+		return t.gaming_account(stub, args)
+	} else if function == "bet_value" {										//what a bet would pay if its side won now
+		return t.bet_value(stub, args)
+	} else if function == "bets_for_sale" {									//list bets that can be bought for tokens
+		return t.bets_for_sale(stub, args)
+	} else if function == "player_stats" {									//read a participant's betting totals
+		return t.player_stats(stub, args)
+	} else if function == "game_summary" {									//read the totals for a game
+		return t.game_summary(stub, args)
+	} else if function == "leaderboard" {									//participants ranked by net winnings
+		return t.leaderboard(stub, args)
+	} else if function == "balance" {										//read a user's tokens
+		return t.balance(stub, args)
 	}
 	fmt.Println("query did not find func: " + function)						//error
 
@@ -171,7 +350,7 @@ func (t *SimpleChaincode) Query(stub *shim.ChaincodeStub, function string, args
 // ============================================================================================================================
 // Read - read a variable from chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) read(stub stateStub, args []string) ([]byte, error) {
 	var name, jsonResp string
 	var err error
 
@@ -190,15 +369,34 @@ func (t *SimpleChaincode) read(stub *shim.ChaincodeStub, args []string) ([]byte,
 }
 
 // ============================================================================================================================
-// Delete - remove a key/value pair from state
+// Delete - admins remove a key/value pair from state. Reserved keys are off limits and a live bet that took a stake
+//			 must be refunded with cancel_bet or void_game instead, the game's pot still counts its tokens
 // ============================================================================================================================
-func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
-	if len(args) != 1 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+func (t *SimpleChaincode) Delete(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["admin", "asdf"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
 	}
 	
-	name := args[0]
-	err := stub.DelState(name)													//remove the key from chaincode state
+	name := args[1]
+	if isReservedKey(name) {
+		return nil, errors.New("Cannot delete " + name + ", it is reserved")
+	}
+	betAsBytes, err := stub.GetState(name)
+	if err != nil {
+		return nil, errors.New("Failed to get state")
+	}
+	bet := Bet{}
+	json.Unmarshal(betAsBytes, &bet)											//un stringify it aka JSON.parse()
+	if bet.Name == name && bet.Status == "" && bet.Stake > 0 {
+		return nil, errors.New("Bet " + name + " still holds a stake of " + strconv.Itoa(bet.Stake) + ", cancel it or void its game to refund it")
+	}
+	err = stub.DelState(name)													//remove the key from chaincode state
 	if err != nil {
 		return nil, errors.New("Failed to delete state")
 	}
@@ -218,7 +416,7 @@ func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byt
 			fmt.Println("found bet")
 			betIndex = append(betIndex[:i], betIndex[i+1:]...)			//remove it
 			for x:= range betIndex{											//debug prints...
-				fmt.Println(string(x) + " - " + betIndex[x])
+				fmt.Println(strconv.Itoa(x) + " - " + betIndex[x])
 			}
 			break
 		}
@@ -229,19 +427,28 @@ func (t *SimpleChaincode) Delete(stub *shim.ChaincodeStub, args []string) ([]byt
 }
 
 // ============================================================================================================================
-// Write - write variable into chaincode state
+// Write - admins write a variable into chaincode state, never over a reserved key
 // ============================================================================================================================
-func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) Write(stub stateStub, args []string) ([]byte, error) {
 	var name, value string // Entities
 	var err error
 	fmt.Println("running write()")
 
-	if len(args) != 2 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 2. name of the variable and value to set")
+	//	0		1		2
+	//["admin", "name", "value"]
+	if len(args) != 3 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 3. admin, name of the variable and value to set")
+	}
+	err = requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
 	}
 
-	name = args[0]															//rename for funsies
-	value = args[1]
+	name = args[1]															//rename for funsies
+	value = args[2]
+	if isReservedKey(name) {
+		return nil, errors.New("Cannot write to " + name + ", it is reserved")
+	}
 	err = stub.PutState(name, []byte(value))								//write the variable into the chaincode state
 	if err != nil {
 		return nil, err
@@ -249,17 +456,24 @@ func (t *SimpleChaincode) Write(stub *shim.ChaincodeStub, args []string) ([]byte
 	return nil, nil
 }
 
+// ============================================================================================================================
+// isReservedKey - true for the "abc" reserve and every "_" key the chaincode keeps its own records under
+// ============================================================================================================================
+func isReservedKey(name string) bool {
+	return name == reserveStr || strings.HasPrefix(name, "_")
+}
+
 // ============================================================================================================================
 // Init Bet - create a new bet, store into chaincode state
 // ============================================================================================================================
-func (t *SimpleChaincode) init_bet(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) init_bet(stub stateStub, args []string) ([]byte, error) {
 	var err error
 
-	//   0       1       2     3
-	// "asdf", "blue", "35", "bob"
-	// 3 should now either be either 1 or 2 to indicate player 1 or 2
-	if len(args) != 4 {
-		return nil, errors.New("Incorrect number of arguments. Expecting 4")
+	//   0       1       2     3     4       5
+	// "asdf", "blue", "35", "bob", "game", "side"
+	// 3 is a registered participant, 5 must be one of the game's sides
+	if len(args) != 6 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 6")
 	}
 
 	//input sanitation
@@ -276,16 +490,29 @@ func (t *SimpleChaincode) init_bet(stub *shim.ChaincodeStub, args []string) ([]b
 	if len(args[3]) <= 0 {
 		return nil, errors.New("4th argument must be a non-empty string")
 	}
+	if len(args[4]) <= 0 {
+		return nil, errors.New("5th argument must be a non-empty string")
+	}
+	if len(args[5]) <= 0 {
+		return nil, errors.New("6th argument must be a non-empty string")
+	}
 	name := args[0]
 	color := strings.ToLower(args[1])
-	//user := strings.ToLower(args[3])
-	user, err := strconv.Atoi(args[3])
-	if err != nil {
-		return nil, errors.New("4th argument must be a numeric string, 1 or 2")
+	user := strings.ToLower(args[3])
+	side := args[5]
+	if isReservedKey(name) {
+		return nil, errors.New("Bet names cannot start with _ or be abc")
+	}
+	if !isParticipant(stub, user) {
+		return nil, errors.New("4th argument must be a registered participant")
 	}
 	size, err := strconv.Atoi(args[2])
+	if err != nil || size <= 0 {
+		return nil, errors.New("3rd argument must be a positive numeric string")
+	}
+	err = checkCaller(stub, user)											//the stake comes out of their balance
 	if err != nil {
-		return nil, errors.New("3rd argument must be a numeric string")
+		return nil, err
 	}
 
 	//check if bet already exists
@@ -301,9 +528,63 @@ func (t *SimpleChaincode) init_bet(stub *shim.ChaincodeStub, args []string) ([]b
 		return nil, errors.New("This bet arleady exists")				//all stop a bet by this name exists
 	}
 	
-	//build the bet json string manually
-	str := `{"name": "` + name + `", "color": "` + color + `", "size": ` + strconv.Itoa(size) + `, "user": "` + strconv.Itoa(user) + `"}`
-	err = stub.PutState(name, []byte(str))									//store bet with id as key
+	//attach the bet to its game
+	game, err := getGame(stub, args[4])
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "open" {
+		return nil, errors.New("Game is not taking bets")
+	}
+	if !hasSide(game, side) {
+		return nil, errors.New("6th argument must be one of the game's sides")
+	}
+	err = checkLimits(stub, user, game.ID, size)							//betting limits and exclusions
+	if err != nil {
+		return nil, err
+	}
+	err = debit(stub, user, size)											//the stake goes into the pot
+	if err != nil {
+		return nil, err
+	}
+	err = updateStats(stub, user, func(stats *PlayerStats) {
+		stats.BetsPlaced++
+		stats.Wagered += size
+	})
+	if err != nil {
+		return nil, err
+	}
+	odds := 0
+	if game.Mode == "fixed" {
+		odds = game.FixedOdds[side]
+		if odds <= 0 {
+			return nil, errors.New("No odds are offered on this side yet")
+		}
+	}
+	if game.Pools == nil {
+		game.Pools = map[string]int{}
+	}
+	game.Bets = append(game.Bets, name)
+	game.Pot += size
+	game.Pools[side] += size
+	if game.Mode == "fixed" {
+		if game.Liability == nil {
+			game.Liability = map[string]int{}
+		}
+		game.Liability[side] += size * odds / 100
+		err = checkExposure(stub, game)										//the house must be able to pay whichever side wins
+		if err != nil {
+			return nil, err
+		}
+	}
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+	
+	bet := Bet{Name: name, Color: color, Size: size, User: user, Stake: size, Game: game.ID, Side: side, Odds: odds}
+	jsonAsBytes, _ := json.Marshal(bet)
+	err = stub.PutState(name, jsonAsBytes)									//store bet with id as key
 	if err != nil {
 		return nil, err
 	}
@@ -319,7 +600,7 @@ func (t *SimpleChaincode) init_bet(stub *shim.ChaincodeStub, args []string) ([]b
 	//append
 	betIndex = append(betIndex, name)									//add bet name to index list
 	fmt.Println("! bet index: ", betIndex)
-	jsonAsBytes, _ := json.Marshal(betIndex)
+	jsonAsBytes, _ = json.Marshal(betIndex)
 	err = stub.PutState(betIndexStr, jsonAsBytes)						//store name of bet
 
 	fmt.Println("- end init bet")
@@ -329,7 +610,7 @@ func (t *SimpleChaincode) init_bet(stub *shim.ChaincodeStub, args []string) ([]b
 // ============================================================================================================================
 // Set User Permission on Bet
 // ============================================================================================================================
-func (t *SimpleChaincode) set_user(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) set_user(stub stateStub, args []string) ([]byte, error) {
 	var err error
 	
 	//   0       1
@@ -340,16 +621,15 @@ func (t *SimpleChaincode) set_user(stub *shim.ChaincodeStub, args []string) ([]b
 	
 	fmt.Println("- start set user")
 	fmt.Println(args[0] + " - " + args[1])
-	betAsBytes, err := stub.GetState(args[0])
+	bet, err := getBet(stub, args[0])
 	if err != nil {
-		return nil, errors.New("Failed to get thing")
+		return nil, err
 	}
-	res := Bet{}
-	json.Unmarshal(betAsBytes, &res)										//un stringify it aka JSON.parse()
-	res.User = args[1]														//change the user
-	
-	jsonAsBytes, _ := json.Marshal(res)
-	err = stub.PutState(args[0], jsonAsBytes)								//rewrite the bet with id as key
+	err = checkCaller(stub, bet.User)										//only the holder gives a bet away
+	if err != nil {
+		return nil, err
+	}
+	err = transferBet(stub, args[0], args[1], 0, "set_user")
 	if err != nil {
 		return nil, err
 	}
@@ -361,7 +641,7 @@ func (t *SimpleChaincode) set_user(stub *shim.ChaincodeStub, args []string) ([]b
 // ============================================================================================================================
 // Open Trade - create an open trade for a bet you want with bets you have 
 // ============================================================================================================================
-func (t *SimpleChaincode) open_trade(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) open_trade(stub stateStub, args []string) ([]byte, error) {
 	var err error
 	var will_size int
 	var trade_away Description
@@ -379,12 +659,19 @@ func (t *SimpleChaincode) open_trade(stub *shim.ChaincodeStub, args []string) ([
 	if err != nil {
 		return nil, errors.New("3rd argument must be a numeric string")
 	}
+	err = checkCaller(stub, args[0])										//the opener's bets are the ones given away
+	if err != nil {
+		return nil, err
+	}
 
 	open := AnOpenTrade{}
 	open.User = args[0]
-	open.Timestamp = makeTimestamp()											//use timestamp as an ID
+	open.Timestamp, err = makeTimestamp(stub)										//use timestamp as an ID
+	if err != nil {
+		return nil, err
+	}
 	open.Want.Color = args[1]
-	open.Want.Size =  size1
+	open.Want.Amount =  size1
 	fmt.Println("- start open trade")
 	jsonAsBytes, _ := json.Marshal(open)
 	err = stub.PutState("_debug1", jsonAsBytes)
@@ -399,7 +686,7 @@ func (t *SimpleChaincode) open_trade(stub *shim.ChaincodeStub, args []string) ([
 		
 		trade_away = Description{}
 		trade_away.Color = args[i]
-		trade_away.Size =  will_size
+		trade_away.Amount =  will_size
 		fmt.Println("! created trade_away: " + args[i])
 		jsonAsBytes, _ = json.Marshal(trade_away)
 		err = stub.PutState("_debug2", jsonAsBytes)
@@ -431,7 +718,7 @@ func (t *SimpleChaincode) open_trade(stub *shim.ChaincodeStub, args []string) ([
 // ============================================================================================================================
 // Perform Trade - close an open trade and move ownership
 // ============================================================================================================================
-func (t *SimpleChaincode) perform_trade(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) perform_trade(stub stateStub, args []string) ([]byte, error) {
 	var err error
 	
 	//	0		1					2					3				4					5
@@ -472,8 +759,16 @@ func (t *SimpleChaincode) perform_trade(stub *shim.ChaincodeStub, args []string)
 			closersBet := Bet{}
 			json.Unmarshal(betAsBytes, &closersBet)											//un stringify it aka JSON.parse()
 			
+			if closersBet.Name != args[2] || strings.ToLower(closersBet.User) != strings.ToLower(args[1]) {
+				return nil, errors.New(args[1] + " does not own " + args[2])
+			}
+			err = checkCaller(stub, args[1])
+			if err != nil {
+				return nil, err
+			}
+			
 			//verify if bet meets trade requirements
-			if closersBet.Color != trades.OpenTrades[i].Want.Color || closersBet.Size != trades.OpenTrades[i].Want.Size {
+			if closersBet.Color != trades.OpenTrades[i].Want.Color || closersBet.Size != trades.OpenTrades[i].Want.Amount {
 				msg := "bet in input does not meet trade requriements"
 				fmt.Println(msg)
 				return nil, errors.New(msg)
@@ -483,8 +778,14 @@ func (t *SimpleChaincode) perform_trade(stub *shim.ChaincodeStub, args []string)
 			if(e == nil){
 				fmt.Println("! no errors, proceeding")
 
-				t.set_user(stub, []string{args[2], trades.OpenTrades[i].User})						//change owner of selected bet, closer -> opener
-				t.set_user(stub, []string{bet.Name, args[1]})									//change owner of selected bet, opener -> closer
+				err = transferBet(stub, args[2], trades.OpenTrades[i].User, 0, "perform_trade")		//change owner of selected bet, closer -> opener
+				if err != nil {
+					return nil, err
+				}
+				err = transferBet(stub, bet.Name, args[1], 0, "perform_trade")						//change owner of selected bet, opener -> closer
+				if err != nil {
+					return nil, err
+				}
 			
 				trades.OpenTrades = append(trades.OpenTrades[:i], trades.OpenTrades[i+1:]...)		//remove trade
 				jsonAsBytes, _ := json.Marshal(trades)
@@ -492,6 +793,7 @@ func (t *SimpleChaincode) perform_trade(stub *shim.ChaincodeStub, args []string)
 				if err != nil {
 					return nil, err
 				}
+				break
 			}
 		}
 	}
@@ -502,7 +804,7 @@ func (t *SimpleChaincode) perform_trade(stub *shim.ChaincodeStub, args []string)
 // ============================================================================================================================
 // findBet4Trade - look for a matching bet that this user owns and return it
 // ============================================================================================================================
-func findBet4Trade(stub *shim.ChaincodeStub, user string, color string, size int )(m Bet, err error){
+func findBet4Trade(stub stateStub, user string, color string, size int )(m Bet, err error){
 	var fail Bet;
 	fmt.Println("- start find bet 4 trade")
 	fmt.Println("looking for " + user + ", " + color + ", " + strconv.Itoa(size));
@@ -527,7 +829,7 @@ func findBet4Trade(stub *shim.ChaincodeStub, user string, color string, size int
 		//fmt.Println("looking @ " + res.User + ", " + res.Color + ", " + strconv.Itoa(res.Size));
 		
 		//check for user && color && size
-		if strings.ToLower(res.User) == strings.ToLower(user) && strings.ToLower(res.Color) == strings.ToLower(color) && res.Size == size{
+		if strings.ToLower(res.User) == strings.ToLower(user) && strings.ToLower(res.Color) == strings.ToLower(color) && res.Size == size && betTradeable(stub, res) == nil{
 			fmt.Println("found a bet: " + res.Name)
 			fmt.Println("! end find bet 4 trade")
 			return res, nil
@@ -539,16 +841,20 @@ func findBet4Trade(stub *shim.ChaincodeStub, user string, color string, size int
 }
 
 // ============================================================================================================================
-// Make Timestamp - create a timestamp in ms
+// Make Timestamp - create a timestamp in ms from the transaction time, never the local clock since peers would disagree
 // ============================================================================================================================
-func makeTimestamp() int64 {
-    return time.Now().UnixNano() / (int64(time.Millisecond)/int64(time.Nanosecond))
+func makeTimestamp(stub stateStub) (int64, error) {
+	ts, err := stub.GetTxTimestamp()											//the transaction's time is the same on every peer and on replay
+	if err != nil || ts == nil {
+		return 0, errors.New("Failed to get transaction timestamp")
+	}
+	return ts.Seconds * 1000 + int64(ts.Nanos) / int64(time.Millisecond), nil
 }
 
 // ============================================================================================================================
 // Remove Open Trade - close an open trade
 // ============================================================================================================================
-func (t *SimpleChaincode) remove_trade(stub *shim.ChaincodeStub, args []string) ([]byte, error) {
+func (t *SimpleChaincode) remove_trade(stub stateStub, args []string) ([]byte, error) {
 	var err error
 	
 	//	0
@@ -592,7 +898,7 @@ func (t *SimpleChaincode) remove_trade(stub *shim.ChaincodeStub, args []string)
 // ============================================================================================================================
 // Clean Up Open Trades - make sure open trades are still possible, remove choices that are no longer possible, remove trades that have no valid choices
 // ============================================================================================================================
-func cleanTrades(stub *shim.ChaincodeStub)(err error){
+func cleanTrades(stub stateStub)(err error){
 	var didWork = false
 	fmt.Println("- start clean trades")
 	
@@ -611,7 +917,7 @@ func cleanTrades(stub *shim.ChaincodeStub)(err error){
 		fmt.Println("# options " + strconv.Itoa(len(trades.OpenTrades[i].Willing)))
 		for x:=0; x<len(trades.OpenTrades[i].Willing); {														//find a bet that is suitable
 			fmt.Println("! on next option " + strconv.Itoa(i) + ":" + strconv.Itoa(x))
-			_, e := findBet4Trade(stub, trades.OpenTrades[i].User, trades.OpenTrades[i].Willing[x].Color, trades.OpenTrades[i].Willing[x].Size)
+			_, e := findBet4Trade(stub, trades.OpenTrades[i].User, trades.OpenTrades[i].Willing[x].Color, trades.OpenTrades[i].Willing[x].Amount)
 			if(e != nil){
 				fmt.Println("! errors with this option, removing option")
 				didWork = true
@@ -0,0 +1,254 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"encoding/json"
+	"strings"
+)
+
+var refundIndexStr = "_refundindex"			//name for the key/value that will store a list of all refund record keys
+var refundPrefix = "_refund_"				//prefix for the key/value that stores one refund record
+
+type Refund struct{
+	Bet string `json:"bet"`
+	User string `json:"user"`					//holder the stake was paid back to
+	Game string `json:"game"`
+	Amount int `json:"amount"`
+	Reason string `json:"reason"`				//"cancel_bet" or "void_game"
+	By string `json:"by"`						//who asked for it
+	TxID string `json:"tx_id"`
+	Timestamp int64 `json:"timestamp"`			//tx time in seconds
+}
+
+// ============================================================================================================================
+// Cancel Bet - the holder withdraws a bet and gets their stake back, only while the game is still open
+// ============================================================================================================================
+func (t *SimpleChaincode) cancel_bet(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["asdf", "bob"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start cancel bet")
+	betAsBytes, err := stub.GetState(args[0])
+	if err != nil {
+		return nil, errors.New("Failed to get bet")
+	}
+	bet := Bet{}
+	json.Unmarshal(betAsBytes, &bet)											//un stringify it aka JSON.parse()
+	if bet.Name != args[0] || bet.Status != "" {
+		return nil, errors.New("Did not find an active bet " + args[0])
+	}
+	if strings.ToLower(bet.User) != strings.ToLower(args[1]) {
+		return nil, errors.New("Only the holder of a bet can cancel it")
+	}
+	err = checkCaller(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	game, err := getGame(stub, bet.Game)
+	if err != nil {
+		return nil, err
+	}
+	if game.Status != "open" {
+		return nil, errors.New("Bets can only be cancelled before the game locks")
+	}
+
+	//take the stake back out of the game
+	for i, name := range game.Bets {
+		if name == bet.Name {
+			game.Bets = append(game.Bets[:i], game.Bets[i+1:]...)
+			break
+		}
+	}
+	game.Pot -= bet.Size
+	game.Pools[bet.Side] -= bet.Size
+	if game.Mode == "fixed" && game.Liability != nil {
+		game.Liability[bet.Side] -= bet.Size * bet.Odds / 100
+	}
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	err = refundBet(stub, bet, "cancel_bet", args[1], "cancelled")
+	if err != nil {
+		return nil, err
+	}
+	err = removeFromBetIndex(stub, bet.Name)									//no longer tradeable
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end cancel bet")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Void Game - admins call off a game with bets on it, every stake is paid back to whoever holds the bet
+// ============================================================================================================================
+func (t *SimpleChaincode) void_game(stub stateStub, args []string) ([]byte, error) {
+	//	0		1
+	//["admin", "game"]
+	if len(args) != 2 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 2")
+	}
+
+	fmt.Println("- start void game")
+	err := requireAdmin(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	game, err := getGame(stub, args[1])
+	if err != nil {
+		return nil, err
+	}
+	if game.Status == "resolved" || game.Status == "cancelled" || game.Status == "void" {
+		return nil, errors.New("Game has already been " + game.Status)
+	}
+
+	for _, name := range game.Bets {
+		betAsBytes, err := stub.GetState(name)
+		if err != nil {
+			return nil, errors.New("Failed to get bet " + name)
+		}
+		bet := Bet{}
+		json.Unmarshal(betAsBytes, &bet)										//un stringify it aka JSON.parse()
+		if bet.Name != name || bet.Status != "" {								//bet was deleted or already refunded
+			continue
+		}
+		err = refundBet(stub, bet, "void_game", args[0], "refunded")
+		if err != nil {
+			return nil, err
+		}
+	}
+	game.Status = "void"
+	err = putGame(stub, game)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println("- end void game")
+	return nil, nil
+}
+
+// ============================================================================================================================
+// Refunds - every refund record, or just those for one game
+// ============================================================================================================================
+func (t *SimpleChaincode) refunds(stub stateStub, args []string) ([]byte, error) {
+	//	0
+	//["game"]   - optional
+	refundsAsBytes, err := stub.GetState(refundIndexStr)
+	if err != nil {
+		return nil, errors.New("Failed to get refund index")
+	}
+	var refundIndex []string
+	json.Unmarshal(refundsAsBytes, &refundIndex)								//un stringify it aka JSON.parse()
+
+	res := []Refund{}
+	for _, key := range refundIndex {
+		refundAsBytes, err := stub.GetState(key)
+		if err != nil {
+			return nil, errors.New("Failed to get refund " + key)
+		}
+		refund := Refund{}
+		json.Unmarshal(refundAsBytes, &refund)									//un stringify it aka JSON.parse()
+		if len(args) == 0 || refund.Game == args[0] {
+			res = append(res, refund)
+		}
+	}
+	return json.Marshal(res)
+}
+
+// ============================================================================================================================
+// refundBet - pay a bet's stake back to its holder, mark the bet and keep an audit record of the refund. Only the
+// tokens init_bet took are paid back, a bet that never took any refunds nothing
+// ============================================================================================================================
+func refundBet(stub stateStub, bet Bet, reason string, by string, status string) error {
+	now, err := txTimestamp(stub)
+	if err != nil {
+		return err
+	}
+	fmt.Println("! refunding " + bet.User + " " + strconv.Itoa(bet.Stake) + " for " + bet.Name)
+	if bet.Stake > 0 {
+		err = credit(stub, bet.User, bet.Stake)
+		if err != nil {
+			return err
+		}
+	}
+	err = updateStats(stub, bet.User, func(stats *PlayerStats) {
+		stats.Refunded += bet.Stake
+	})
+	if err != nil {
+		return err
+	}
+
+	bet.Status = status
+	bet.Payout = bet.Stake
+	jsonAsBytes, _ := json.Marshal(bet)
+	err = stub.PutState(bet.Name, jsonAsBytes)									//rewrite the bet with its refund
+	if err != nil {
+		return err
+	}
+
+	refund := Refund{Bet: bet.Name, User: bet.User, Game: bet.Game, Amount: bet.Stake, Reason: reason, By: strings.ToLower(by), TxID: stub.GetTxID(), Timestamp: now}
+	key := refundPrefix + refund.TxID + "_" + bet.Name
+	jsonAsBytes, _ = json.Marshal(refund)
+	err = stub.PutState(key, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+
+	refundsAsBytes, err := stub.GetState(refundIndexStr)
+	if err != nil {
+		return errors.New("Failed to get refund index")
+	}
+	var refundIndex []string
+	json.Unmarshal(refundsAsBytes, &refundIndex)								//un stringify it aka JSON.parse()
+	refundIndex = append(refundIndex, key)
+	jsonAsBytes, _ = json.Marshal(refundIndex)
+	return stub.PutState(refundIndexStr, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// removeFromBetIndex - drop a bet name from the bet index
+// ============================================================================================================================
+func removeFromBetIndex(stub stateStub, name string) error {
+	betsAsBytes, err := stub.GetState(betIndexStr)
+	if err != nil {
+		return errors.New("Failed to get bet index")
+	}
+	var betIndex []string
+	json.Unmarshal(betsAsBytes, &betIndex)										//un stringify it aka JSON.parse()
+	for i, val := range betIndex {
+		if val == name {
+			betIndex = append(betIndex[:i], betIndex[i+1:]...)
+			break
+		}
+	}
+	jsonAsBytes, _ := json.Marshal(betIndex)
+	return stub.PutState(betIndexStr, jsonAsBytes)
+}
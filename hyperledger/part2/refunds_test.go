@@ -0,0 +1,117 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package main
+
+import (
+	"testing"
+)
+
+func TestCancelBetLeavesBalancesUnchanged(t *testing.T) {
+	l := newLedger(t)
+	l.participants("100", "bob")
+	l.as("deployer")
+	l.must("create_game", "admin", "g1", "red", "blue")
+
+	l.as("bob")
+	l.must("init_bet", "b1", "red", "40", "bob", "g1", "red")
+	if bal := l.balance("bob"); bal != 60 {
+		t.Fatalf("bob holds %d after betting 40, want 60", bal)
+	}
+	l.must("cancel_bet", "b1", "bob")
+	if bal := l.balance("bob"); bal != 100 {
+		t.Fatalf("bob holds %d after cancelling, want 100", bal)
+	}
+	if game := l.game("g1"); game.Pot != 0 || game.Pools["red"] != 0 {
+		t.Fatalf("pot %d and red pool %d left after cancelling, want 0", game.Pot, game.Pools["red"])
+	}
+}
+
+func TestCancelBetCannotMintTokens(t *testing.T) {
+	l := newLedger(t)
+	l.participants("100", "bob")
+	l.as("deployer")
+	l.must("create_game", "admin", "g1", "red", "blue")
+
+	l.as("bob")
+	l.fails("Insufficient balance", "init_bet", "b1", "red", "1000000", "bob", "g1", "red")
+	l.fails("Did not find an active bet", "cancel_bet", "b1", "bob")
+	if bal := l.balance("bob"); bal != 100 {
+		t.Fatalf("bob holds %d, want 100", bal)
+	}
+}
+
+func TestVoidGameRefundsEveryStake(t *testing.T) {
+	l := newLedger(t)
+	l.participants("100", "bob", "alice")
+	l.as("deployer")
+	l.must("create_game", "admin", "g1", "red", "blue")
+	l.as("bob")
+	l.must("init_bet", "b1", "red", "30", "bob", "g1", "red")
+	l.as("alice")
+	l.must("init_bet", "b2", "red", "20", "alice", "g1", "blue")
+
+	l.as("deployer")
+	l.must("void_game", "admin", "g1")
+	for _, user := range []string{"bob", "alice"} {
+		if bal := l.balance(user); bal != 100 {
+			t.Fatalf("%s holds %d after the void, want 100", user, bal)
+		}
+	}
+	var refunds []Refund
+	l.query(&refunds, "refunds", "g1")
+	if len(refunds) != 2 || refunds[0].Amount+refunds[1].Amount != 50 {
+		t.Fatalf("refunds %+v, want 2 adding up to 50", refunds)
+	}
+}
+
+func TestOnlyAdminsDeleteAndWrite(t *testing.T) {
+	l := newLedger(t)
+	l.participants("100", "eve")
+
+	l.as("eve")
+	l.fails("Only an admin", "write", "eve", "_balance_eve", "1000000")
+	l.fails("Only an admin", "delete", "eve", "abc")
+	l.as("deployer")
+	l.fails("it is reserved", "write", "admin", "_balance_eve", "1000000")
+	l.fails("it is reserved", "delete", "admin", "_balance_eve")
+	l.must("write", "admin", "note", "hello")
+	l.must("delete", "admin", "note")
+	if bal := l.balance("eve"); bal != 100 {
+		t.Fatalf("eve holds %d, want 100", bal)
+	}
+}
+
+func TestDeleteRefusesAStakedBet(t *testing.T) {
+	l := newLedger(t)
+	l.participants("100", "bob")
+	l.as("deployer")
+	l.must("create_game", "admin", "g1", "red", "blue")
+	l.as("bob")
+	l.fails("cannot start with _", "init_bet", "_balance_bob", "red", "40", "bob", "g1", "red")
+	l.must("init_bet", "b1", "red", "40", "bob", "g1", "red")
+
+	l.as("deployer")
+	l.fails("still holds a stake", "delete", "admin", "b1")
+	l.must("void_game", "admin", "g1")
+	l.must("delete", "admin", "b1")
+	if bal := l.balance("bob"); bal != 100 {
+		t.Fatalf("bob holds %d after the void, want 100", bal)
+	}
+}
@@ -0,0 +1,206 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+
+package main
+
+import (
+	"errors"
+	"strconv"
+	"encoding/json"
+	"sort"
+	"strings"
+)
+
+var statsPrefix = "_stats_"					//prefix for the key/value that stores a participant's betting totals
+var leaderboardStr = "_leaderboard"			//name for the key/value that will store participants ranked by net
+
+type PlayerStats struct{
+	User string `json:"user"`
+	BetsPlaced int `json:"bets_placed"`		//stakes count toward whoever placed the bet
+	Wagered int `json:"wagered"`
+	BetsWon int `json:"bets_won"`			//payouts count toward whoever held the bet at settlement
+	BetsLost int `json:"bets_lost"`
+	Won int `json:"won"`					//total paid out
+	Lost int `json:"lost"`					//stakes of bets that paid nothing
+	Refunded int `json:"refunded"`			//stakes paid back by cancel_bet and void_game
+	Net int `json:"net"`					//won + refunded - wagered, open bets count against it until they settle
+}
+
+type LeaderEntry struct{
+	User string `json:"user"`
+	Net int `json:"net"`
+	Wagered int `json:"wagered"`
+}
+
+// byNet ranks the leaderboard by net winnings, ties by name. sort.Slice is newer than the Go of the fabric v0.6 image
+type byNet []LeaderEntry
+
+func (b byNet) Len() int { return len(b) }
+func (b byNet) Swap(i, j int) { b[i], b[j] = b[j], b[i] }
+func (b byNet) Less(i, j int) bool {
+	if b[i].Net != b[j].Net {
+		return b[i].Net > b[j].Net
+	}
+	return b[i].User < b[j].User
+}
+
+type GameSummary struct{
+	Game string `json:"game"`
+	Status string `json:"status"`
+	Winner string `json:"winner"`
+	Bets int `json:"bets"`
+	Pot int `json:"pot"`
+	Pools map[string]int `json:"pools"`
+	Paid int `json:"paid"`
+	HouseTake int `json:"house_take"`
+}
+
+// ============================================================================================================================
+// Player Stats - read a participant's betting totals
+// ============================================================================================================================
+func (t *SimpleChaincode) player_stats(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting name of the participant to query")
+	}
+
+	stats, err := getStats(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(stats)
+}
+
+// ============================================================================================================================
+// Game Summary - the bets, pools and payout totals for a game
+// ============================================================================================================================
+func (t *SimpleChaincode) game_summary(stub stateStub, args []string) ([]byte, error) {
+	if len(args) != 1 {
+		return nil, errors.New("Incorrect number of arguments. Expecting 1")
+	}
+
+	game, err := getGame(stub, args[0])
+	if err != nil {
+		return nil, err
+	}
+	summary := GameSummary{Game: game.ID, Status: game.Status, Winner: game.Winner, Bets: len(game.Bets), Pot: game.Pot, Pools: game.Pools, Paid: game.Paid, HouseTake: game.HouseTake}
+	return json.Marshal(summary)
+}
+
+// ============================================================================================================================
+// Leaderboard - participants ranked by net winnings, optionally just the top n
+// ============================================================================================================================
+func (t *SimpleChaincode) leaderboard(stub stateStub, args []string) ([]byte, error) {
+	//	0
+	//["10"]   - optional
+	board, err := getLeaderboard(stub)
+	if err != nil {
+		return nil, err
+	}
+	if len(args) > 0 {
+		top, err := strconv.Atoi(args[0])
+		if err != nil || top < 0 {
+			return nil, errors.New("1st argument must be a non-negative numeric string")
+		}
+		if top < len(board) {
+			board = board[:top]
+		}
+	}
+	return json.Marshal(board)
+}
+
+// ============================================================================================================================
+// recordSettled - count a settled bet toward its holder's totals
+// ============================================================================================================================
+func recordSettled(stub stateStub, bet Bet) error {
+	return updateStats(stub, bet.User, func(stats *PlayerStats) {
+		if bet.Payout > 0 {
+			stats.BetsWon++
+			stats.Won += bet.Payout
+		} else {
+			stats.BetsLost++
+			stats.Lost += bet.Size
+		}
+	})
+}
+
+// ============================================================================================================================
+// updateStats - change a participant's totals and move them to their new place on the leaderboard
+// ============================================================================================================================
+func updateStats(stub stateStub, user string, change func(stats *PlayerStats)) error {
+	stats, err := getStats(stub, user)
+	if err != nil {
+		return err
+	}
+	change(&stats)
+	stats.Net = stats.Won + stats.Refunded - stats.Wagered
+	jsonAsBytes, _ := json.Marshal(stats)
+	err = stub.PutState(statsPrefix + stats.User, jsonAsBytes)
+	if err != nil {
+		return err
+	}
+
+	board, err := getLeaderboard(stub)
+	if err != nil {
+		return err
+	}
+	found := false
+	for i := range board {
+		if board[i].User == stats.User {
+			board[i].Net = stats.Net
+			board[i].Wagered = stats.Wagered
+			found = true
+			break
+		}
+	}
+	if !found {
+		board = append(board, LeaderEntry{User: stats.User, Net: stats.Net, Wagered: stats.Wagered})
+	}
+	sort.Sort(byNet(board))
+	jsonAsBytes, _ = json.Marshal(board)
+	return stub.PutState(leaderboardStr, jsonAsBytes)
+}
+
+// ============================================================================================================================
+// getStats - read a participant's totals, empty if they have never bet
+// ============================================================================================================================
+func getStats(stub stateStub, user string) (PlayerStats, error) {
+	user = strings.ToLower(user)
+	stats := PlayerStats{}
+	statsAsBytes, err := stub.GetState(statsPrefix + user)
+	if err != nil {
+		return stats, errors.New("Failed to get stats for " + user)
+	}
+	json.Unmarshal(statsAsBytes, &stats)										//un stringify it aka JSON.parse()
+	stats.User = user
+	return stats, nil
+}
+
+// ============================================================================================================================
+// getLeaderboard - read the ranked participants
+// ============================================================================================================================
+func getLeaderboard(stub stateStub) ([]LeaderEntry, error) {
+	board := []LeaderEntry{}
+	boardAsBytes, err := stub.GetState(leaderboardStr)
+	if err != nil {
+		return nil, errors.New("Failed to get leaderboard")
+	}
+	json.Unmarshal(boardAsBytes, &board)										//un stringify it aka JSON.parse()
+	return board, nil
+}
@@ -0,0 +1,141 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package oracle is how game results are signed by an oracle and checked by the bet chaincode.
+//
+// An oracle signs the sha256 of a json report naming the game, the report round and the winning side.
+// The round starts at 0 and goes up every time a reported result is overturned, so signatures from
+// an earlier round cannot be submitted again.
+package oracle
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+)
+
+// signature is the ASN.1 shape of an ECDSA signature. It is spelled out rather than using
+// ecdsa.SignASN1, which needs a newer Go than the fabric v0.6 build image has.
+type signature struct {
+	R, S *big.Int
+}
+
+// Report is what an oracle signs.
+type Report struct {
+	Game  string `json:"game"`
+	Round int    `json:"round"`
+	Side  string `json:"side"`
+}
+
+// Message is the digest an oracle signs for a result.
+func Message(game string, round int, side string) []byte {
+	report, _ := json.Marshal(Report{Game: game, Round: round, Side: side})
+	sum := sha256.Sum256(report)
+	return sum[:]
+}
+
+// Sign returns the hex of an ASN.1 ECDSA signature over a result, what submit_result expects.
+func Sign(key *ecdsa.PrivateKey, game string, round int, side string) (string, error) {
+	r, s, err := ecdsa.Sign(rand.Reader, key, Message(game, round, side))
+	if err != nil {
+		return "", err
+	}
+	sig, err := asn1.Marshal(signature{R: r, S: s})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(sig), nil
+}
+
+// Verify checks a hex signature over a result against the hex of an oracle's public key.
+func Verify(keyHex string, game string, round int, side string, sigHex string) error {
+	key, err := ParsePublicKey(keyHex)
+	if err != nil {
+		return err
+	}
+	der, err := hex.DecodeString(sigHex)
+	if err != nil {
+		return errors.New("Signature must be a hex string")
+	}
+	var sig signature
+	rest, err := asn1.Unmarshal(der, &sig)
+	if err != nil || len(rest) > 0 || sig.R == nil || sig.S == nil {
+		return errors.New("Signature must be an ASN.1 ECDSA signature")
+	}
+	if !ecdsa.Verify(key, Message(game, round, side), sig.R, sig.S) {
+		return errors.New("Signature does not match this oracle and result")
+	}
+	return nil
+}
+
+// ParsePublicKey decodes the hex of a PKIX DER encoded ECDSA public key.
+func ParsePublicKey(keyHex string) (*ecdsa.PublicKey, error) {
+	der, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, errors.New("Oracle key must be a hex string")
+	}
+	pub, err := x509.ParsePKIXPublicKey(der)
+	if err != nil {
+		return nil, errors.New("Oracle key is not a PKIX public key")
+	}
+	key, ok := pub.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Oracle key must be an ECDSA key")
+	}
+	return key, nil
+}
+
+// NewKey makes a P-256 key for a stand-in oracle.
+func NewKey() (*ecdsa.PrivateKey, error) {
+	return ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+}
+
+// PublicKeyHex is the hex of a key's PKIX DER encoded public half, what register_oracle expects.
+func PublicKeyHex(key *ecdsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(der), nil
+}
+
+// PrivateKeyHex is the hex of a key's SEC 1 DER encoding, so a stand-in oracle can be saved and loaded.
+func PrivateKeyHex(key *ecdsa.PrivateKey) (string, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(der), nil
+}
+
+// ParsePrivateKey decodes what PrivateKeyHex wrote.
+func ParsePrivateKey(keyHex string) (*ecdsa.PrivateKey, error) {
+	der, err := hex.DecodeString(keyHex)
+	if err != nil {
+		return nil, errors.New("Private key must be a hex string")
+	}
+	return x509.ParseECPrivateKey(der)
+}
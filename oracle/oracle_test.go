@@ -0,0 +1,93 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package oracle
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSignVerify(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := PublicKeyHex(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(key, "g1", 2, "red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Verify(pub, "g1", 2, "red", sig); err != nil {
+		t.Fatalf("own signature: %v", err)
+	}
+	if Verify(pub, "g1", 1, "red", sig) == nil {
+		t.Fatal("signature from round 2 verified for round 1")
+	}
+	if Verify(pub, "g1", 2, "blue", sig) == nil {
+		t.Fatal("signature for red verified for blue")
+	}
+}
+
+func TestMessageIsUnambiguous(t *testing.T) {
+	if bytes.Equal(Message("a:b", 0, "c"), Message("a", 0, "b:c")) {
+		t.Fatal("game and side boundary is ambiguous")
+	}
+}
+
+func TestPrivateKeyRoundTrip(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	priv, err := PrivateKeyHex(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := ParsePrivateKey(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !back.Equal(key) {
+		t.Fatal("key changed on the way through hex")
+	}
+}
+
+func TestVerifyRejectsMalformedSignatures(t *testing.T) {
+	key, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pub, err := PublicKeyHex(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := Sign(key, "g1", 0, "red")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, bad := range []string{"zz", "", "3000", sig + "00"} {
+		if err := Verify(pub, "g1", 0, "red", bad); err == nil {
+			t.Errorf("Verify accepted signature %q", bad)
+		}
+	}
+}
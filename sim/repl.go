@@ -0,0 +1,300 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sim
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/randyramnansingh/marbles-chaincode/txlog"
+)
+
+const help = `commands:
+  <function> args...      invoke, e.g. init_marble blue1 blue 35 bob
+  init args...            call Init, e.g. init 100 admin
+  query <function> args   run a query, e.g. query read _marbleindex
+  get <key>               print one key
+  keys [prefix]           list the keys in state
+  time [seconds]          show or set the clock, the next transaction runs one step later
+  step <seconds>          how far the clock moves each transaction
+  caller [cert]           sign the next transactions with this certificate text, no cert runs without security
+  save <file>             write the session to a file
+  load <file>             read a session back
+  verbose on|off          show what the chaincode prints
+  help                    this text
+  quit
+args are split on spaces, wrap an arg in "double" or 'single' quotes to keep spaces or json together`
+
+// Main runs the simulator for one chaincode: a REPL by default, or the commands in -script files.
+func Main(name string, cc Chaincode) {
+	stateFile := flag.String("state", "", "file backed state, loaded at start and saved after every transaction")
+	script := flag.String("script", "", "run the commands in this file instead of a REPL, - reads stdin")
+	keepGoing := flag.Bool("keep-going", false, "in script mode, carry on after a failed command")
+	start := flag.Int64("time", time.Now().Unix(), "clock in seconds since epoch before the first transaction")
+	verbose := flag.Bool("v", false, "show what the chaincode prints")
+	record := flag.String("record", "", "append every transaction to this txlog file")
+	replay := flag.String("replay", "", "run the transactions in this txlog file, report any outcome that differs and exit 1 if one does")
+	flag.Parse()
+
+	s := NewSession(name, cc, *start)
+	s.Quiet = !*verbose
+	s.Log = *record
+	if *stateFile != "" {
+		if _, err := os.Stat(*stateFile); err == nil {
+			if err := s.Load(*stateFile); err != nil {
+				fmt.Println("Error: " + err.Error())
+				os.Exit(1)
+			}
+		}
+	}
+
+	if *replay != "" {
+		entries, err := txlog.Read(*replay)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+		diverged := s.ReplayLog(entries, os.Stdout)
+		if *stateFile != "" {
+			if err := s.Save(*stateFile); err != nil {
+				fmt.Println("Error: " + err.Error())
+				os.Exit(1)
+			}
+		}
+		if len(diverged) > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if *script == "" {
+		fmt.Println(name + " simulator, type help for commands")
+		s.Loop(os.Stdin, os.Stdout, true, true, *stateFile)
+		return
+	}
+	in := os.Stdin
+	if *script != "-" {
+		file, err := os.Open(*script)
+		if err != nil {
+			fmt.Println("Error: " + err.Error())
+			os.Exit(1)
+		}
+		defer file.Close()
+		in = file
+	}
+	if !s.Loop(in, os.Stdout, false, *keepGoing, *stateFile) {
+		os.Exit(1)
+	}
+}
+
+// Loop reads commands until the input ends or quit. It returns false if a command failed,
+// without keepGoing it stops at the first failure. Lines starting with # are comments.
+func (s *Session) Loop(in io.Reader, out io.Writer, prompt bool, keepGoing bool, stateFile string) bool {
+	ok := true
+	scanner := bufio.NewScanner(in)
+	scanner.Buffer(make([]byte, 1024*1024), 16*1024*1024)
+	for line := 1; ; line++ {
+		if prompt {
+			fmt.Fprint(out, "> ")
+		}
+		if !scanner.Scan() {
+			break
+		}
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		if !prompt {
+			fmt.Fprintln(out, "> "+text)
+		}
+		words, err := Split(text)
+		if err == nil && (words[0] == "quit" || words[0] == "exit") {
+			break
+		}
+		if err == nil {
+			err = s.Command(words, out)
+		}
+		if err == nil && stateFile != "" {
+			err = s.Save(stateFile)
+		}
+		if err != nil {
+			ok = false
+			if prompt {
+				fmt.Fprintln(out, "Error: "+err.Error())
+			} else {
+				fmt.Fprintln(out, "Error on line "+strconv.Itoa(line)+": "+err.Error())
+			}
+			if !keepGoing {
+				return false
+			}
+		}
+	}
+	return ok
+}
+
+// Command runs one split command line and prints what happened.
+func (s *Session) Command(words []string, out io.Writer) error {
+	switch words[0] {
+	case "help":
+		fmt.Fprintln(out, help)
+		return nil
+	case "get":
+		if len(words) != 2 {
+			return errors.New("usage: get <key>")
+		}
+		fmt.Fprintln(out, string(s.State[words[1]]))
+		return nil
+	case "keys":
+		var keys []string
+		for key := range s.State {
+			if len(words) < 2 || strings.HasPrefix(key, words[1]) {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintln(out, key)
+		}
+		return nil
+	case "time":
+		if len(words) == 2 {
+			secs, err := strconv.ParseInt(words[1], 10, 64)
+			if err != nil {
+				return errors.New("usage: time [seconds since epoch]")
+			}
+			s.Time = secs - s.Step //the next transaction lands on it
+		}
+		fmt.Fprintln(out, strconv.FormatInt(s.Time+s.Step, 10))
+		return nil
+	case "step":
+		if len(words) != 2 {
+			return errors.New("usage: step <seconds>")
+		}
+		step, err := strconv.ParseInt(words[1], 10, 64)
+		if err != nil || step < 0 {
+			return errors.New("usage: step <seconds>")
+		}
+		s.Step = step
+		return nil
+	case "save", "load":
+		if len(words) != 2 {
+			return errors.New("usage: " + words[0] + " <file>")
+		}
+		if words[0] == "save" {
+			return s.Save(words[1])
+		}
+		return s.Load(words[1])
+	case "caller":
+		if len(words) > 2 {
+			return errors.New("usage: caller [cert]")
+		}
+		s.Caller = nil
+		if len(words) == 2 {
+			s.Caller = []byte(words[1])
+		}
+		return nil
+	case "verbose":
+		if len(words) != 2 || (words[1] != "on" && words[1] != "off") {
+			return errors.New("usage: verbose on|off")
+		}
+		s.Quiet = words[1] == "off"
+		return nil
+	case "init":
+		return s.report(s.Run("init", "init", words[1:]), out)
+	case "query":
+		if len(words) < 2 {
+			return errors.New("usage: query <function> args...")
+		}
+		return s.report(s.Run("query", words[1], words[2:]), out)
+	}
+	return s.report(s.Run("invoke", words[0], words[1:]), out)
+}
+
+// report prints the payload, event and state changes of a transaction.
+func (s *Session) report(res Result, out io.Writer) error {
+	if res.Err != nil {
+		return res.Err
+	}
+	if len(res.Payload) > 0 {
+		fmt.Fprintln(out, string(res.Payload))
+	}
+	if res.Event != nil {
+		fmt.Fprintln(out, "event "+res.Event.Name+" "+res.Event.Payload)
+	}
+	for _, change := range res.Changes {
+		switch {
+		case change.Old == "":
+			fmt.Fprintln(out, "+ "+change.Key+" = "+change.New)
+		case change.New == "":
+			fmt.Fprintln(out, "- "+change.Key)
+		default:
+			fmt.Fprintln(out, "~ "+change.Key+" = "+change.New)
+		}
+	}
+	return nil
+}
+
+// Split breaks a command line on spaces, quotes keep spaces together. Inside double quotes \" and \\ are escapes.
+func Split(line string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord := false
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case c == ' ' || c == '\t':
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		case c == '"' || c == '\'':
+			inWord = true
+			end := i + 1
+			for ; end < len(line) && line[end] != c; end++ {
+				if c == '"' && line[end] == '\\' && end+1 < len(line) {
+					end++
+				}
+				word.WriteByte(line[end])
+			}
+			if end >= len(line) {
+				return nil, errors.New("missing closing quote")
+			}
+			i = end
+		default:
+			inWord = true
+			word.WriteByte(c)
+		}
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	if len(words) == 0 {
+		return nil, errors.New("empty command")
+	}
+	return words, nil
+}
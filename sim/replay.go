@@ -0,0 +1,101 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sim
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/randyramnansingh/marbles-chaincode/txlog"
+)
+
+// Divergence is a replayed transaction whose outcome differs from the one recorded.
+type Divergence struct {
+	Index  int //position in the log, from 1
+	Entry  txlog.Entry
+	Result string
+	Error  string
+}
+
+// ReplayLog runs every entry of a txlog again and prints each one that came out differently,
+// followed by the state it ended with. A log that replays cleanly passes as a regression test.
+func (s *Session) ReplayLog(entries []txlog.Entry, out io.Writer) []Divergence {
+	var diverged []Divergence
+	for i, entry := range entries {
+		res := s.Replay(entry)
+		got := Divergence{Index: i + 1, Entry: entry, Result: string(res.Payload)}
+		if res.Err != nil {
+			got.Error = res.Err.Error()
+		}
+		if got.Error == entry.Error && (got.Error != "" || got.Result == entry.Result) { //a failure's payload is never returned
+			continue
+		}
+		diverged = append(diverged, got)
+		fmt.Fprintln(out, "diverged at entry "+strconv.Itoa(got.Index)+": "+describe(entry))
+		fmt.Fprintln(out, "  recorded: "+outcome(entry.Result, entry.Error))
+		fmt.Fprintln(out, "  replayed: "+outcome(got.Result, got.Error))
+	}
+
+	var keys []string
+	for key := range s.State {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	fmt.Fprintln(out, "state after "+strconv.Itoa(len(entries))+" entries:")
+	for _, key := range keys {
+		fmt.Fprintln(out, "  "+key+" = "+string(s.State[key]))
+	}
+	fmt.Fprintln(out, strconv.Itoa(len(diverged))+" of "+strconv.Itoa(len(entries))+" entries diverged")
+	return diverged
+}
+
+// describe prints an entry the way it would be typed into the REPL.
+func describe(entry txlog.Entry) string {
+	words := []string{entry.Function}
+	if entry.Kind == "init" {
+		words = []string{"init"}
+	} else if entry.Kind == "query" {
+		words = []string{"query", entry.Function}
+	}
+	for _, arg := range entry.Args {
+		if arg == "" || strings.ContainsAny(arg, " \t\"'") {
+			arg = strconv.Quote(arg)
+		}
+		words = append(words, arg)
+	}
+	line := strings.Join(words, " ")
+	if entry.TxID != "" {
+		line += "  (tx " + entry.TxID + ")"
+	}
+	return line
+}
+
+func outcome(result string, err string) string {
+	if err != "" {
+		return "error " + err
+	}
+	if result == "" {
+		return "ok, no payload"
+	}
+	return result
+}
@@ -0,0 +1,269 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package sim runs a chaincode against local state so it can be tried without a peer.
+//
+// Each chaincode directory builds a simulator of itself with the marblesim build tag:
+//
+//	go run -tags marblesim ./experimental
+//
+// or through cmd/marblesim, which picks the chaincode by name.
+package sim
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/randyramnansingh/marbles-chaincode/txlog"
+)
+
+// Chaincode is what a chaincode directory hands to Main, its handlers run against a *Stub instead of the shim.
+type Chaincode interface {
+	Init(stub *Stub, args []string) ([]byte, error)
+	Invoke(stub *Stub, function string, args []string) ([]byte, error)
+	Query(stub *Stub, function string, args []string) ([]byte, error)
+}
+
+// Event is what a transaction passed to SetEvent.
+type Event struct {
+	Name    string `json:"name"`
+	Payload string `json:"payload"`
+}
+
+// Stub stands in for the shim's ChaincodeStub during one transaction. Writes land in State directly,
+// the session keeps a copy to roll back to when the transaction fails.
+type Stub struct {
+	State   map[string][]byte
+	TxID    string
+	Time    int64 //seconds since epoch, what GetTxTimestamp reports
+	Nanos   int32
+	Creator []byte //what GetCallerCertificate reports
+	Event   *Event
+}
+
+func (s *Stub) GetState(key string) ([]byte, error) {
+	return s.State[key], nil
+}
+
+func (s *Stub) PutState(key string, value []byte) error {
+	if key == "" {
+		return errors.New("key must not be empty")
+	}
+	s.State[key] = append([]byte(nil), value...)
+	return nil
+}
+
+func (s *Stub) DelState(key string) error {
+	delete(s.State, key)
+	return nil
+}
+
+func (s *Stub) GetTxID() string {
+	return s.TxID
+}
+
+func (s *Stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: s.Time, Nanos: s.Nanos}, nil
+}
+
+func (s *Stub) GetCallerCertificate() ([]byte, error) {
+	return s.Creator, nil
+}
+
+func (s *Stub) SetEvent(name string, payload []byte) error {
+	s.Event = &Event{Name: name, Payload: string(payload)}
+	return nil
+}
+
+// Change is one key a transaction wrote or deleted.
+type Change struct {
+	Key string `json:"key"`
+	Old string `json:"old,omitempty"`
+	New string `json:"new,omitempty"`
+}
+
+// Diff lists the keys that differ between two states, in key order.
+func Diff(before, after map[string][]byte) []Change {
+	var changes []Change
+	for key, value := range after {
+		if old, ok := before[key]; !ok || string(old) != string(value) {
+			changes = append(changes, Change{Key: key, Old: string(old), New: string(value)})
+		}
+	}
+	for key, old := range before {
+		if _, ok := after[key]; !ok {
+			changes = append(changes, Change{Key: key, Old: string(old)})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+func copyState(state map[string][]byte) map[string][]byte {
+	dup := make(map[string][]byte, len(state))
+	for key, value := range state {
+		dup[key] = value
+	}
+	return dup
+}
+
+// session is what save writes and load reads.
+type session struct {
+	Chaincode string            `json:"chaincode"`
+	Tx        int               `json:"tx"`
+	Time      int64             `json:"time"`
+	State     map[string]string `json:"state"`
+}
+
+// Save writes the state, transaction counter and clock to a json file.
+func (s *Session) Save(path string) error {
+	out := session{Chaincode: s.Name, Tx: s.Tx, Time: s.Time, State: map[string]string{}}
+	for key, value := range s.State {
+		out.State[key] = string(value)
+	}
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+// Load replaces the state, transaction counter and clock with those saved in a json file.
+func (s *Session) Load(path string) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var in session
+	err = json.Unmarshal(data, &in)
+	if err != nil {
+		return err
+	}
+	if in.Chaincode != "" && in.Chaincode != s.Name {
+		return errors.New(path + " was saved from " + in.Chaincode + ", not " + s.Name)
+	}
+	s.State = map[string][]byte{}
+	for key, value := range in.State {
+		s.State[key] = []byte(value)
+	}
+	s.Tx, s.Time = in.Tx, in.Time
+	return nil
+}
+
+// Result is what one transaction did.
+type Result struct {
+	Payload []byte
+	Err     error
+	Event   *Event
+	Changes []Change
+}
+
+// Session holds the state between transactions.
+type Session struct {
+	Name      string
+	Chaincode Chaincode
+	State     map[string][]byte
+	Tx        int    //transactions run so far, names the next tx id
+	Time      int64  //clock of the last transaction
+	Step      int64  //seconds the clock moves for each transaction
+	Quiet     bool   //hide what the chaincode prints
+	Log       string //when set, every transaction is appended to this txlog file
+	Caller    []byte //certificate the next transactions are signed with, nil runs without security
+}
+
+// NewSession starts an empty state with the clock at start.
+func NewSession(name string, cc Chaincode, start int64) *Session {
+	return &Session{Name: name, Chaincode: cc, State: map[string][]byte{}, Time: start, Step: 1, Quiet: true}
+}
+
+// Run sends one transaction to the chaincode, "init" goes to Init. A failed invoke leaves the state as it was,
+// like a peer would. Queries never change the state.
+func (s *Session) Run(kind string, function string, args []string) Result {
+	if kind != "query" { //queries are not transactions
+		s.Tx++
+		s.Time += s.Step
+	}
+	return s.run(txlog.Entry{Kind: kind, Function: function, Args: args, TxID: "sim-" + strconv.Itoa(s.Tx), Seconds: s.Time, Creator: hex.EncodeToString(s.Caller)})
+}
+
+// Replay runs a recorded transaction again with the tx id, clock and creator it had when it was recorded.
+func (s *Session) Replay(entry txlog.Entry) Result {
+	if entry.Kind != "query" {
+		s.Tx++
+		s.Time = entry.Seconds
+	}
+	if entry.TxID == "" {
+		entry.TxID = "sim-" + strconv.Itoa(s.Tx)
+	}
+	return s.run(entry)
+}
+
+func (s *Session) run(entry txlog.Entry) Result {
+	before := copyState(s.State)
+	stub := &Stub{State: copyState(s.State), TxID: entry.TxID, Time: entry.Seconds, Nanos: entry.Nanos}
+	if entry.Creator != "" {
+		stub.Creator, _ = hex.DecodeString(entry.Creator)
+	}
+
+	restore := s.mute()
+	var res Result
+	switch entry.Kind {
+	case "init":
+		res.Payload, res.Err = s.Chaincode.Init(stub, entry.Args)
+	case "query":
+		res.Payload, res.Err = s.Chaincode.Query(stub, entry.Function, entry.Args)
+	default:
+		res.Payload, res.Err = s.Chaincode.Invoke(stub, entry.Function, entry.Args)
+	}
+	restore()
+	if s.Log != "" {
+		txlog.RecordTo(s.Log, stub, entry.Kind, entry.Function, entry.Args, res.Payload, res.Err)
+	}
+
+	if res.Err != nil || entry.Kind == "query" {
+		return res
+	}
+	s.State = stub.State
+	res.Event = stub.Event
+	res.Changes = Diff(before, s.State)
+	return res
+}
+
+// mute sends what the chaincode prints to nowhere when the session is quiet, and returns how to undo it.
+func (s *Session) mute() func() {
+	if !s.Quiet {
+		return func() {}
+	}
+	devnull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return func() {}
+	}
+	stdout := os.Stdout
+	os.Stdout = devnull
+	return func() {
+		os.Stdout = stdout
+		devnull.Close()
+	}
+}
@@ -0,0 +1,166 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package sim
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// kv is a tiny chaincode: put writes a key, fail writes one and then errors, get reads one
+type kv struct{}
+
+func (kv) Init(stub *Stub, args []string) ([]byte, error) {
+	return nil, stub.PutState("init", []byte(strings.Join(args, " ")))
+}
+
+func (kv) Invoke(stub *Stub, function string, args []string) ([]byte, error) {
+	switch function {
+	case "put":
+		return nil, stub.PutState(args[0], []byte(args[1]))
+	case "fail":
+		stub.PutState(args[0], []byte("half done"))
+		return nil, errors.New("failed on purpose")
+	}
+	return nil, errors.New("unknown function " + function)
+}
+
+func (kv) Query(stub *Stub, function string, args []string) ([]byte, error) {
+	return stub.GetState(args[0])
+}
+
+func TestSplit(t *testing.T) {
+	cases := []struct {
+		line string
+		want []string
+	}{
+		{"init_marble blue1 blue 35 bob", []string{"init_marble", "blue1", "blue", "35", "bob"}},
+		{"  put\tk   v  ", []string{"put", "k", "v"}},
+		{`put k "two words"`, []string{"put", "k", "two words"}},
+		{`put k '{"a": 1}'`, []string{"put", "k", `{"a": 1}`}},
+		{`put k "say \"hi\" \\ bye"`, []string{"put", "k", `say "hi" \ bye`}},
+		{`put k ""`, []string{"put", "k", ""}},
+		{`put k pre"fix"`, []string{"put", "k", "prefix"}},
+	}
+	for _, c := range cases {
+		got, err := Split(c.line)
+		if err != nil || !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Split(%q) = %q, %v, want %q", c.line, got, err, c.want)
+		}
+	}
+	for _, line := range []string{"", "   ", `put k "open`} {
+		if _, err := Split(line); err == nil {
+			t.Errorf("Split(%q) did not fail", line)
+		}
+	}
+}
+
+func TestFailedInvokeLeavesStateAlone(t *testing.T) {
+	s := NewSession("kv", kv{}, 1000)
+	if res := s.Run("invoke", "put", []string{"a", "1"}); res.Err != nil || len(res.Changes) != 1 {
+		t.Fatalf("put: %v, changes %v", res.Err, res.Changes)
+	}
+	if res := s.Run("invoke", "fail", []string{"a"}); res.Err == nil {
+		t.Fatal("fail did not fail")
+	}
+	if got := string(s.State["a"]); got != "1" {
+		t.Fatalf("a = %q after a failed invoke, want 1", got)
+	}
+	if s.Tx != 2 || s.Time != 1002 {
+		t.Fatalf("tx %d at %d, want 2 transactions one step apart", s.Tx, s.Time)
+	}
+}
+
+func TestLoop(t *testing.T) {
+	script := "# seed\ninit x y\nput a 1\n\nbogus\nput b 2\nquit\nput c 3\n"
+
+	s := NewSession("kv", kv{}, 1000)
+	var out strings.Builder
+	if s.Loop(strings.NewReader(script), &out, false, false, "") {
+		t.Fatal("Loop reported success with a failing command")
+	}
+	if !strings.Contains(out.String(), "Error on line 5: unknown function bogus") {
+		t.Fatalf("output does not name the failing line:\n%s", out.String())
+	}
+	if _, ok := s.State["b"]; ok {
+		t.Fatal("Loop carried on after a failure without keepGoing")
+	}
+
+	s = NewSession("kv", kv{}, 1000)
+	out.Reset()
+	if s.Loop(strings.NewReader(script), &out, false, true, "") {
+		t.Fatal("Loop reported success with a failing command")
+	}
+	if string(s.State["init"]) != "x y" || string(s.State["b"]) != "2" {
+		t.Fatalf("state %q, want init and b written", s.State)
+	}
+	if _, ok := s.State["c"]; ok {
+		t.Fatal("Loop carried on after quit")
+	}
+	if !strings.Contains(out.String(), "+ a = 1") {
+		t.Fatalf("output does not show the changes:\n%s", out.String())
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "session.json")
+
+	s := NewSession("kv", kv{}, 1000)
+	s.Run("invoke", "put", []string{"a", `{"json": true}`})
+	s.Run("invoke", "put", []string{"b", "2"})
+	if err := s.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded := NewSession("kv", kv{}, 0)
+	loaded.State["stale"] = []byte("x")
+	if err := loaded.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(loaded.State, s.State) || loaded.Tx != s.Tx || loaded.Time != s.Time {
+		t.Fatalf("loaded tx %d at %d with %q, want tx %d at %d with %q", loaded.Tx, loaded.Time, loaded.State, s.Tx, s.Time, s.State)
+	}
+
+	other := NewSession("other", kv{}, 0)
+	if err := other.Load(path); err == nil || !strings.Contains(err.Error(), "was saved from kv") {
+		t.Fatalf("loading another chaincode's session: %v", err)
+	}
+}
+
+func TestLoopSavesStateFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+	s := NewSession("kv", kv{}, 1000)
+	var out strings.Builder
+	if !s.Loop(strings.NewReader("put a 1\nput b 2\n"), &out, false, false, path) {
+		t.Fatalf("Loop failed:\n%s", out.String())
+	}
+
+	next := NewSession("kv", kv{}, 0)
+	if err := next.Load(path); err != nil {
+		t.Fatal(err)
+	}
+	if string(next.State["b"]) != "2" || next.Tx != 2 {
+		t.Fatalf("state file holds tx %d with %q, want both puts", next.Tx, next.State)
+	}
+}
@@ -0,0 +1,239 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// marblecsv sends a partner inventory spreadsheet to the marbles chaincode's import_marbles_csv invoke in chunks.
+//
+//	marblecsv [-dry-run] [-chunk 100] [-peer http://localhost:7050 -chaincode <name> [-user <enrollId>]] inventory.csv
+//
+// Rows are name,color,size,owner with optional minter and attributes columns, a header row is skipped.
+// The chaincode checks each row on its own and skips the bad ones, so one bad row never holds back the rest.
+// With -peer each chunk is first run as the import_marbles_csv query, which reports the rows that would fail with
+// their line in the file, then invoked unless -dry-run is set. Invokes only answer with a transaction id, so the
+// query's report is the one printed. Rows that clash with a chunk still being committed are only caught by the invoke.
+// Without -peer each chunk is printed as the args for the import_marbles_csv invoke.
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// chunk is some rows of the file re-encoded as csv, with the file line each of its lines came from.
+type chunk struct {
+	text  string
+	lines map[int]int
+	rows  int
+}
+
+// report is what import_marbles_csv answers with.
+type report struct {
+	Created []string `json:"created"`
+	Errors  []struct {
+		Line  int    `json:"line"`
+		Name  string `json:"name"`
+		Error string `json:"error"`
+	} `json:"errors"`
+}
+
+func main() {
+	dryRun := flag.Bool("dry-run", false, "only run the import_marbles_csv query, do not invoke")
+	chunkSize := flag.Int("chunk", 100, "rows per import_marbles_csv invocation")
+	peer := flag.String("peer", "", "peer REST address, leave empty to print the invocation args")
+	chaincode := flag.String("chaincode", "", "chaincode name to invoke")
+	user := flag.String("user", "", "enrollment id for the secure context, if security is on")
+	flag.Parse()
+	if flag.NArg() != 1 || *chunkSize <= 0 || (*peer != "" && *chaincode == "") {
+		fmt.Println("usage: marblecsv [-dry-run] [-chunk 100] [-peer http://localhost:7050 -chaincode <name> [-user <enrollId>]] inventory.csv")
+		os.Exit(2)
+	}
+
+	file, err := os.Open(flag.Arg(0))
+	if err != nil {
+		fail(err)
+	}
+	chunks, failed := readChunks(file, *chunkSize)
+	file.Close()
+
+	for n, c := range chunks {
+		if *peer == "" {
+			args, _ := json.Marshal([]string{c.text})
+			fmt.Println(string(args))
+			continue
+		}
+		res, err := call(*peer, "query", *chaincode, *user, "import_marbles_csv", []string{c.text}, 2*n+1)
+		if err != nil {
+			fail(fmt.Errorf("chunk %d: %s", n+1, err))
+		}
+		var rep report
+		err = json.Unmarshal([]byte(res), &rep)
+		if err != nil {
+			fail(fmt.Errorf("chunk %d: %s", n+1, err))
+		}
+		for _, e := range rep.Errors {
+			fmt.Fprintf(os.Stderr, "line %d %s: %s\n", c.lines[e.Line], e.Name, e.Error)
+		}
+		failed += len(rep.Errors)
+		if *dryRun {
+			fmt.Printf("chunk %d: %d rows would be created, %d rows have errors\n", n+1, len(rep.Created), len(rep.Errors))
+			continue
+		}
+		txid, err := call(*peer, "invoke", *chaincode, *user, "import_marbles_csv", []string{c.text}, 2*n+2)
+		if err != nil {
+			fail(fmt.Errorf("chunk %d: %s", n+1, err))
+		}
+		fmt.Printf("chunk %d: %d rows submitted in %s, %d rows have errors\n", n+1, c.rows, txid, len(rep.Errors))
+	}
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// readChunks splits the file into chunks of rows, dropping a header row. Rows the csv reader cannot parse are
+// reported here, everything else is left for the chaincode to check.
+func readChunks(r io.Reader, size int) ([]chunk, int) {
+	text, err := ioutil.ReadAll(r)
+	if err != nil {
+		fail(err)
+	}
+
+	var chunks []chunk
+	var buf bytes.Buffer
+	writer := csv.NewWriter(&buf)
+	cur := chunk{lines: map[int]int{}}
+	next := 1 //line of the chunk the next row starts on
+	failed := 0
+	for i, row := range splitRows(string(text)) {
+		if row.err != nil {
+			fmt.Fprintf(os.Stderr, "line %d: %s\n", row.line, row.err)
+			failed++
+			continue
+		}
+		if i == 0 && len(row.fields) > 2 && strings.ToLower(row.fields[0]) == "name" {
+			continue
+		}
+
+		cur.lines[next] = row.line
+		writer.Write(row.fields)
+		writer.Flush()
+		next = bytes.Count(buf.Bytes(), []byte("\n")) + 1
+		cur.rows++
+		if cur.rows == size {
+			cur.text = buf.String()
+			chunks = append(chunks, cur)
+			buf.Reset()
+			cur = chunk{lines: map[int]int{}}
+			next = 1
+		}
+	}
+	if cur.rows > 0 {
+		cur.text = buf.String()
+		chunks = append(chunks, cur)
+	}
+	return chunks, failed
+}
+
+// row is one csv record and the file line it starts on.
+type row struct {
+	line   int
+	fields []string
+	err    error
+}
+
+// splitRows parses csv text row by row the way the chaincode's import does, joining lines while a quote is left open
+// and skipping blank lines. csv.Reader only reports where a record starts from Go 1.17 on, so lines are counted here.
+func splitRows(text string) []row {
+	lines := strings.Split(text, "\n")
+	var rows []row
+	for i := 0; i < len(lines); i++ {
+		start := i
+		record := strings.TrimSuffix(lines[i], "\r")
+		for strings.Count(record, "\"")%2 == 1 && i+1 < len(lines) {
+			i++
+			record += "\n" + strings.TrimSuffix(lines[i], "\r")
+		}
+		if len(record) == 0 {
+			continue
+		}
+
+		reader := csv.NewReader(strings.NewReader(record))
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		fields, err := reader.Read()
+		r := row{line: start + 1, fields: fields, err: err}
+		if pe, ok := err.(*csv.ParseError); ok {
+			r.line = start + pe.Line
+			r.err = pe.Err
+		}
+		rows = append(rows, r)
+	}
+	return rows
+}
+
+// call sends one JSON-RPC request to the peer's /chaincode endpoint and returns the message it answers with.
+func call(peer, method, chaincode, user, function string, args []string, id int) (string, error) {
+	params := map[string]interface{}{
+		"type":        1,
+		"chaincodeID": map[string]string{"name": chaincode},
+		"ctorMsg":     map[string]interface{}{"function": function, "args": args},
+	}
+	if user != "" {
+		params["secureContext"] = user
+	}
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "method": method, "params": params, "id": id})
+	resp, err := http.Post(strings.TrimRight(peer, "/")+"/chaincode", "application/json", bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var answer struct {
+		Result *struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"result"`
+		Error *struct {
+			Message string `json:"message"`
+			Data    string `json:"data"`
+		} `json:"error"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&answer)
+	if err != nil {
+		return "", err
+	}
+	if answer.Error != nil {
+		return "", fmt.Errorf("%s %s", answer.Error.Message, answer.Error.Data)
+	}
+	if answer.Result == nil {
+		return "", fmt.Errorf("peer answered %s with no result", resp.Status)
+	}
+	return answer.Result.Message, nil
+}
+
+func fail(err error) {
+	fmt.Println("Error: " + err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,77 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// oraclesigner is a local stand-in for a results oracle, for trying out the Bet chaincode's submit_result.
+//
+//	oraclesigner keygen                              - prints a private key and the public key to pass to register_oracle
+//	oraclesigner sign <private key> game round side  - prints the signature to pass to submit_result
+//
+// The round is the game's "round" field, 0 until a reported result is overturned. Tests sign with the oracle package directly.
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/randyramnansingh/marbles-chaincode/oracle"
+)
+
+func main() {
+	if len(os.Args) == 2 && os.Args[1] == "keygen" {
+		key, err := oracle.NewKey()
+		if err != nil {
+			fail(err)
+		}
+		priv, err := oracle.PrivateKeyHex(key)
+		if err != nil {
+			fail(err)
+		}
+		pub, err := oracle.PublicKeyHex(key)
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println("private: " + priv)
+		fmt.Println("public:  " + pub)
+		return
+	}
+	if len(os.Args) == 6 && os.Args[1] == "sign" {
+		key, err := oracle.ParsePrivateKey(os.Args[2])
+		if err != nil {
+			fail(err)
+		}
+		round, err := strconv.Atoi(os.Args[4])
+		if err != nil {
+			fail(err)
+		}
+		sig, err := oracle.Sign(key, os.Args[3], round, os.Args[5])
+		if err != nil {
+			fail(err)
+		}
+		fmt.Println(sig)
+		return
+	}
+	fmt.Println("usage: oraclesigner keygen | oraclesigner sign <private key> <game> <round> <side>")
+	os.Exit(2)
+}
+
+func fail(err error) {
+	fmt.Println("Error: " + err.Error())
+	os.Exit(1)
+}
@@ -0,0 +1,134 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+// Package txlog records what each invocation of a chaincode did, one json line per transaction,
+// so the simulator can replay it later and point out where the outcome changed.
+//
+// A chaincode records only when the MARBLES_TXLOG environment variable names a file.
+package txlog
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"os"
+	"strconv"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+// EnvVar names the file a chaincode appends entries to.
+const EnvVar = "MARBLES_TXLOG"
+
+// Entry is one recorded invocation.
+type Entry struct {
+	Kind     string   `json:"kind"` //"init", "invoke" or "query"
+	Function string   `json:"function"`
+	Args     []string `json:"args"`
+	Creator  string   `json:"creator,omitempty"` //hex of the caller's certificate
+	TxID     string   `json:"tx_id,omitempty"`
+	Seconds  int64    `json:"seconds"` //transaction time
+	Nanos    int32    `json:"nanos,omitempty"`
+	Result   string   `json:"result,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+// Stub is what Record needs from the shim.
+type Stub interface {
+	GetTxID() string
+	GetTxTimestamp() (*timestamp.Timestamp, error)
+	GetCallerCertificate() ([]byte, error)
+}
+
+// Record appends an entry for this invocation to the MARBLES_TXLOG file, if one is set.
+func Record(stub Stub, kind string, function string, args []string, res []byte, err error) {
+	if path := os.Getenv(EnvVar); path != "" {
+		RecordTo(path, stub, kind, function, args, res, err)
+	}
+}
+
+// RecordTo appends an entry for this invocation to a log file.
+// Recording must never fail a transaction, so problems are printed and otherwise ignored.
+func RecordTo(path string, stub Stub, kind string, function string, args []string, res []byte, err error) {
+	entry := Entry{Kind: kind, Function: function, Args: args, TxID: stub.GetTxID(), Result: string(res)}
+	if kind == "query" {
+		entry.TxID = ""
+	}
+	if ts, e := stub.GetTxTimestamp(); e == nil && ts != nil {
+		entry.Seconds, entry.Nanos = ts.Seconds, ts.Nanos
+	}
+	if cert, e := stub.GetCallerCertificate(); e == nil {
+		entry.Creator = hex.EncodeToString(cert)
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if e := Append(path, entry); e != nil {
+		println("txlog: " + e.Error())
+	}
+}
+
+// Append writes one entry to the end of a log file.
+func Append(path string, entry Entry) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	line, _ := json.Marshal(entry)
+	_, err = file.Write(append(line, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// Read loads every entry of a log file in order.
+func Read(path string) ([]Entry, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var entries []Entry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 1024*1024), 64*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, &LineError{Path: path, Line: line, Err: err}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, scanner.Err()
+}
+
+// LineError is a log line that is not an entry.
+type LineError struct {
+	Path string
+	Line int
+	Err  error
+}
+
+func (e *LineError) Error() string {
+	return e.Path + " line " + strconv.Itoa(e.Line) + ": " + e.Err.Error()
+}
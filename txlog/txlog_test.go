@@ -0,0 +1,69 @@
+/*
+Licensed to the Apache Software Foundation (ASF) under one
+or more contributor license agreements.  See the NOTICE file
+distributed with this work for additional information
+regarding copyright ownership.  The ASF licenses this file
+to you under the Apache License, Version 2.0 (the
+"License"); you may not use this file except in compliance
+with the License.  You may obtain a copy of the License at
+
+  http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing,
+software distributed under the License is distributed on an
+"AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+KIND, either express or implied.  See the License for the
+specific language governing permissions and limitations
+under the License.
+*/
+
+package txlog
+
+import (
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/timestamp"
+)
+
+type stub struct{}
+
+func (stub) GetTxID() string { return "tx1" }
+
+func (stub) GetTxTimestamp() (*timestamp.Timestamp, error) {
+	return &timestamp.Timestamp{Seconds: 1700000000, Nanos: 5000000}, nil
+}
+
+func (stub) GetCallerCertificate() ([]byte, error) { return []byte("bob"), nil }
+
+func TestRecordAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "txlog.ndjson")
+	RecordTo(path, stub{}, "invoke", "transfer", []string{"bob", "alice", "5"}, nil, errors.New("Insufficient balance"))
+	RecordTo(path, stub{}, "query", "read", []string{"m1"}, []byte(`{"name":"m1"}`), nil)
+
+	entries, err := Read(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Entry{
+		{Kind: "invoke", Function: "transfer", Args: []string{"bob", "alice", "5"}, Creator: "626f62", TxID: "tx1", Seconds: 1700000000, Nanos: 5000000, Error: "Insufficient balance"},
+		{Kind: "query", Function: "read", Args: []string{"m1"}, Creator: "626f62", Seconds: 1700000000, Nanos: 5000000, Result: `{"name":"m1"}`},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Fatalf("read %+v, want %+v", entries, want)
+	}
+}
+
+func TestReadNamesTheBadLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "txlog.ndjson")
+	if err := ioutil.WriteFile(path, []byte("{\"kind\":\"init\"}\n\nnot json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Read(path)
+	if lineErr, ok := err.(*LineError); !ok || lineErr.Line != 3 {
+		t.Fatalf("got %v, want an error on line 3", err)
+	}
+}